@@ -0,0 +1,383 @@
+package cookclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/macrat/cookfs/cooklib"
+	"github.com/macrat/cookfs/plugins"
+)
+
+var (
+	ErrNotFound    = fmt.Errorf("not found")
+	ErrNoLeader    = fmt.Errorf("leader not found")
+	ErrUnavailable = fmt.Errorf("no server available")
+	ErrInvalidData = fmt.Errorf("invalid response data")
+)
+
+type StatusError struct {
+	Path       string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to request %s: %d", e.Path, e.StatusCode)
+}
+
+func statusError(path string, code int) error {
+	switch code {
+	case 200, 204:
+		return nil
+	case 404:
+		return ErrNotFound
+	case 502, 503:
+		return ErrUnavailable
+	default:
+		return &StatusError{path, code}
+	}
+}
+
+type Client struct {
+	Servers []*cooklib.Node
+	Handler cooklib.CommunicationHandler
+
+	Replicas     int
+	MinChunkSize int
+	ChunkSize    int
+	MaxChunkSize int
+
+	Timeout     time.Duration
+	Retries     int
+	Consistency cooklib.Consistency
+}
+
+func NewClient(servers []*cooklib.Node) *Client {
+	return &Client{
+		Servers:      servers,
+		Handler:      &plugins.HTTPHandler{},
+		Replicas:     2,
+		MinChunkSize: 256 * 1024,
+		ChunkSize:    1024 * 1024,
+		MaxChunkSize: 4 * 1024 * 1024,
+		Timeout:      10 * time.Second,
+		Retries:      3,
+	}
+}
+
+func (c *Client) send(ctx context.Context, node *cooklib.Node, path string, data interface{}) cooklib.Response {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	return c.Handler.Send(ctx, cooklib.Request{Node: node, Path: path, Data: data})
+}
+
+func (c *Client) request(ctx context.Context, path string, data interface{}) (cooklib.Response, error) {
+	last := cooklib.Response{StatusCode: 502}
+
+	for _, i := range rand.Perm(len(c.Servers)) {
+		resp := c.send(ctx, c.Servers[i], path, data)
+		if resp.StatusCode != 502 && resp.StatusCode != 503 {
+			return resp, statusError(path, resp.StatusCode)
+		}
+		if resp.StatusCode == 503 {
+			last = resp
+		}
+	}
+
+	return last, statusError(path, last.StatusCode)
+}
+
+func (c *Client) Info(ctx context.Context) (*cooklib.AliveMessage, error) {
+	resp, err := c.request(ctx, "/term", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := resp.Data.(*cooklib.AliveMessage)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+
+	return info, nil
+}
+
+func (c *Client) Leader(ctx context.Context) (*cooklib.Node, error) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Leader == nil || info.Leader.String() == "" {
+		return nil, ErrNoLeader
+	}
+
+	return info.Leader, nil
+}
+
+func (c *Client) mutate(ctx context.Context, path string, request interface{}) (cooklib.Response, error) {
+	err := ErrNoLeader
+
+	for i := 0; i <= c.Retries; i++ {
+		for _, j := range rand.Perm(len(c.Servers)) {
+			resp := c.send(ctx, c.Servers[j], path, request)
+			if resp.StatusCode == 307 {
+				if redirect, ok := resp.Data.(*cooklib.AliveMessage); ok && redirect.Leader != nil {
+					resp = c.send(ctx, redirect.Leader, path, request)
+				}
+			}
+
+			if resp.StatusCode == 200 {
+				return resp, nil
+			}
+			if resp.StatusCode != 502 && resp.StatusCode != 503 && resp.StatusCode != 307 {
+				return resp, statusError(path, resp.StatusCode)
+			}
+			if resp.StatusCode == 503 {
+				err = ErrUnavailable
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return cooklib.Response{}, ctx.Err()
+		case <-time.After(time.Duration(i+1) * 500 * time.Millisecond):
+		}
+	}
+
+	return cooklib.Response{}, err
+}
+
+func (c *Client) commit(ctx context.Context, request cooklib.CommitRequest) error {
+	_, err := c.mutate(ctx, "/commit", request)
+	return err
+}
+
+func (c *Client) pushChunk(ctx context.Context, chunk cooklib.Chunk) ([]*cooklib.Node, error) {
+	holders := []*cooklib.Node{}
+
+	for _, i := range rand.Perm(len(c.Servers)) {
+		ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+		holder, err := c.Handler.SendChunk(ctx, c.Servers[i], chunk)
+		cancel()
+
+		if err == nil {
+			holders = append(holders, holder)
+			if len(holders) >= c.Replicas {
+				break
+			}
+		}
+	}
+
+	if len(holders) == 0 {
+		return nil, ErrUnavailable
+	}
+
+	return holders, nil
+}
+
+func (c *Client) fetchChunk(ctx context.Context, holders []*cooklib.Node, id cooklib.ChunkID) ([]byte, error) {
+	candidates := make([]*cooklib.Node, 0, len(holders)+len(c.Servers))
+	for _, i := range rand.Perm(len(holders)) {
+		candidates = append(candidates, holders[i])
+	}
+	for _, i := range rand.Perm(len(c.Servers)) {
+		candidates = append(candidates, c.Servers[i])
+	}
+
+	for _, node := range candidates {
+		ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+		data, err := c.Handler.FetchChunk(ctx, node, id)
+		cancel()
+
+		if err == nil && cooklib.NewChunkID(data) == id {
+			return data, nil
+		}
+	}
+
+	return nil, ErrUnavailable
+}
+
+func (c *Client) Put(ctx context.Context, tag string, r io.Reader) error {
+	chunker, err := cooklib.NewCDCChunker(r, c.MinChunkSize, c.ChunkSize, c.MaxChunkSize)
+	if err != nil {
+		return err
+	}
+
+	recipe := &cooklib.Recipe{Chunks: []cooklib.ChunkID{}}
+	holders := make(cooklib.ChunkHoldersPatch)
+
+	for {
+		data, err := chunker.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		chunk := cooklib.Chunk{ID: cooklib.NewChunkID(data), Data: data}
+
+		nodes, err := c.pushChunk(ctx, chunk)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			holders.AddChunk(node, chunk.ID)
+		}
+
+		recipe.Size += int64(len(data))
+		recipe.Chunks = append(recipe.Chunks, chunk.ID)
+	}
+
+	return c.commit(ctx, cooklib.CommitRequest{
+		Recipes: cooklib.RecipeListPatch{tag: recipe},
+		Chunks:  holders,
+	})
+}
+
+func (c *Client) lookup(ctx context.Context, tag string) (*cooklib.RecipeInfo, error) {
+	resp, err := c.request(ctx, "/recipe", cooklib.RecipeQuery{Tag: tag, Consistency: c.Consistency})
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := resp.Data.(*cooklib.RecipeInfo)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+
+	return info, nil
+}
+
+func (c *Client) Stat(ctx context.Context, tag string) (cooklib.Recipe, error) {
+	info, err := c.lookup(ctx, tag)
+	if err != nil {
+		return cooklib.Recipe{}, err
+	}
+
+	return info.Recipe, nil
+}
+
+func (c *Client) Get(ctx context.Context, tag string) (io.ReadCloser, error) {
+	info, err := c.lookup(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &recipeReader{ctx: ctx, cancel: cancel, client: c, info: info}, nil
+}
+
+func (c *Client) Delete(ctx context.Context, tag string) error {
+	if _, err := c.lookup(ctx, tag); err != nil {
+		return err
+	}
+
+	return c.commit(ctx, cooklib.CommitRequest{
+		Recipes: cooklib.RecipeListPatch{tag: nil},
+	})
+}
+
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	resp, err := c.request(ctx, "/recipe/list", cooklib.RecipeListQuery{Consistency: c.Consistency})
+	if err != nil {
+		return nil, err
+	}
+
+	tags, ok := resp.Data.(*[]string)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+
+	return *tags, nil
+}
+
+func (c *Client) Members(ctx context.Context) (*cooklib.Membership, error) {
+	resp, err := c.request(ctx, "/member/list", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	membership, ok := resp.Data.(*cooklib.Membership)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+
+	return membership, nil
+}
+
+func (c *Client) changeMember(ctx context.Context, node *cooklib.Node, remove bool) (*cooklib.Membership, error) {
+	resp, err := c.mutate(ctx, "/member", cooklib.MemberRequest{Node: node, Remove: remove})
+	if err != nil {
+		return nil, err
+	}
+
+	membership, ok := resp.Data.(*cooklib.Membership)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+
+	return membership, nil
+}
+
+func (c *Client) AddMember(ctx context.Context, node *cooklib.Node) (*cooklib.Membership, error) {
+	return c.changeMember(ctx, node, false)
+}
+
+func (c *Client) RemoveMember(ctx context.Context, node *cooklib.Node) (*cooklib.Membership, error) {
+	return c.changeMember(ctx, node, true)
+}
+
+func (c *Client) TransferLeader(ctx context.Context, node *cooklib.Node) (*cooklib.AliveMessage, error) {
+	resp, err := c.mutate(ctx, "/term/transfer", cooklib.TransferRequest{Node: node})
+	if err != nil {
+		return nil, err
+	}
+
+	alive, ok := resp.Data.(*cooklib.AliveMessage)
+	if !ok {
+		return nil, ErrInvalidData
+	}
+
+	return alive, nil
+}
+
+type recipeReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *Client
+	info   *cooklib.RecipeInfo
+	index  int
+	buf    []byte
+}
+
+func (r *recipeReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.index >= len(r.info.Recipe.Chunks) {
+			return 0, io.EOF
+		}
+
+		id := r.info.Recipe.Chunks[r.index]
+
+		data, err := r.client.fetchChunk(r.ctx, r.info.Holders[id], id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch chunk %s: %s", id, err.Error())
+		}
+
+		r.buf = data
+		r.index++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *recipeReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,169 @@
+package cookclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+
+	"github.com/macrat/cookfs/cooklib"
+)
+
+func newServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *cooklib.Node) {
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+
+	return srv, cooklib.MustParseNode(srv.URL)
+}
+
+func writeData(w http.ResponseWriter, code int, data interface{}) {
+	raw, _ := msgpack.Marshal(data)
+	w.Header().Set("Content-Type", "application/x-msgpack")
+	w.WriteHeader(code)
+	w.Write(raw)
+}
+
+func newTestClient(servers ...*cooklib.Node) *Client {
+	c := NewClient(servers)
+	c.Retries = 1
+	return c
+}
+
+func Test_Client_Redirect(t *testing.T) {
+	var committed int32
+
+	_, leader := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var request cooklib.CommitRequest
+		msgpack.NewDecoder(r.Body).Decode(&request)
+		if _, ok := request.Recipes["/foo"]; ok {
+			atomic.AddInt32(&committed, 1)
+		}
+		writeData(w, 200, cooklib.PatchID{})
+	})
+
+	_, follower := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, 307, cooklib.AliveMessage{Leader: leader, Term: 1})
+	})
+
+	c := newTestClient(follower)
+	if err := c.commit(context.Background(), cooklib.CommitRequest{Recipes: cooklib.RecipeListPatch{"/foo": nil}}); err != nil {
+		t.Fatalf("failed to commit through redirect: %s", err.Error())
+	}
+	if committed != 1 {
+		t.Errorf("unexcepted number of commits on leader: %d", committed)
+	}
+}
+
+func Test_Client_Retry(t *testing.T) {
+	var requests int32
+
+	_, server := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/commit" {
+			w.WriteHeader(404)
+			return
+		}
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		writeData(w, 200, cooklib.PatchID{})
+	})
+
+	c := newTestClient(server)
+	if err := c.commit(context.Background(), cooklib.CommitRequest{}); err != nil {
+		t.Fatalf("failed to commit after retry: %s", err.Error())
+	}
+	if requests != 2 {
+		t.Errorf("unexcepted number of requests: %d", requests)
+	}
+}
+
+func Test_Client_Read(t *testing.T) {
+	var requests int32
+	count := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writeData(w, 200, cooklib.AliveMessage{Term: 1})
+	}
+	_, a := newServer(t, count)
+	_, b := newServer(t, count)
+	_, c := newServer(t, count)
+
+	if _, err := newTestClient(a, b, c).Info(context.Background()); err != nil {
+		t.Fatalf("failed to read: %s", err.Error())
+	}
+	if requests != 1 {
+		t.Errorf("read must be sent to single server but sent to %d", requests)
+	}
+
+	_, unavailable := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	})
+	down, unreachable := newServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	down.Close()
+	_, available := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, 200, cooklib.AliveMessage{Term: 2})
+	})
+
+	for i := 0; i < 10; i++ {
+		if info, err := newTestClient(unavailable, unreachable, available).Info(context.Background()); err != nil || info.Term != 2 {
+			t.Fatalf("must fall back to available server: %v", err)
+		}
+	}
+}
+
+func Test_Client_Errors(t *testing.T) {
+	_, notFound := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	_, broken := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+	_, unavailable := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	})
+	_, invalid := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte{0xc1})
+	})
+	ctx := context.Background()
+
+	if _, err := newTestClient(notFound).Stat(ctx, "/foo"); err != ErrNotFound {
+		t.Errorf("must return ErrNotFound: %v", err)
+	}
+
+	if _, err := newTestClient(broken).Stat(ctx, "/foo"); err == nil {
+		t.Errorf("must fail on server error")
+	} else if e, ok := err.(*StatusError); !ok || e.StatusCode != 500 || e.Path != "/recipe" {
+		t.Errorf("must return StatusError: %v", err)
+	}
+
+	if _, err := newTestClient(unavailable).List(ctx); err != ErrUnavailable {
+		t.Errorf("must return ErrUnavailable: %v", err)
+	}
+	if err := newTestClient(unavailable).commit(ctx, cooklib.CommitRequest{}); err != ErrUnavailable {
+		t.Errorf("must return ErrUnavailable after retries: %v", err)
+	}
+
+	c := newTestClient(invalid)
+	if _, err := c.Info(ctx); err != ErrInvalidData {
+		t.Errorf("must reject undecodable info: %v", err)
+	}
+	if _, err := c.Stat(ctx, "/foo"); err != ErrInvalidData {
+		t.Errorf("must reject undecodable recipe: %v", err)
+	}
+	if _, err := c.List(ctx); err != ErrInvalidData {
+		t.Errorf("must reject undecodable list: %v", err)
+	}
+	if _, err := c.Members(ctx); err != ErrInvalidData {
+		t.Errorf("must reject undecodable members: %v", err)
+	}
+	if _, err := c.AddMember(ctx, notFound); err != ErrInvalidData {
+		t.Errorf("must reject undecodable membership: %v", err)
+	}
+	if _, err := c.TransferLeader(ctx, notFound); err != ErrInvalidData {
+		t.Errorf("must reject undecodable transfer result: %v", err)
+	}
+}
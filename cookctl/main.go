@@ -4,6 +4,7 @@ import (
 	"time"
 	"net/url"
 	"fmt"
+	"io"
 	"os"
 	"math/rand"
 	"encoding/json"
@@ -12,59 +13,135 @@ import (
 	"github.com/alecthomas/kingpin"
 	"github.com/go-yaml/yaml"
 
+	"github.com/macrat/cookfs/cookclient"
 	"github.com/macrat/cookfs/cooklib"
-	"github.com/macrat/cookfs/plugins"
 )
 
-func Request(servers []*cooklib.Node, path string, data interface{}) cooklib.Response {
-	handler := &plugins.HTTPHandler{}
+func Print(data interface{}, format string) {
+	if format == "yaml" {
+		y, _ := yaml.Marshal(data)
+		fmt.Println(string(y))
+	} else {
+		j, _ := json.Marshal(data)
+		fmt.Println(string(j))
+	}
+}
+
+func Info(client *cookclient.Client, format string) error {
+	info, err := client.Info(context.Background())
+	if err != nil {
+		return err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	Print(info, format)
 
-	resp := make(chan cooklib.Response)
+	return nil
+}
 
-	for _, server := range servers {
-		go func(server *cooklib.Node) {
-			r := handler.Send(ctx, cooklib.Request{server, path, data, 0})
-			if r.StatusCode == 200 || r.StatusCode == 204 {
-				resp <- r
-				cancel()
-			}
-		}(server)
+func Upload(client *cookclient.Client, tag string, file *os.File) error {
+	if file == nil {
+		file = os.Stdin
 	}
+	defer file.Close()
 
-	select {
-	case r := <-resp:
-		return r
+	return client.Put(context.Background(), tag, file)
+}
 
-	case <-ctx.Done():
-		return cooklib.Response{StatusCode: 502}
+func Download(client *cookclient.Client, tag string, file *os.File) error {
+	if file == nil {
+		file = os.Stdout
 	}
+	defer file.Close()
+
+	r, err := client.Get(context.Background(), tag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(file, r)
+	return err
 }
 
-func Info(servers []*cooklib.Node, format string) error {
-	resp := Request(servers, "/term", nil)
-	if resp.StatusCode != 200 && resp.StatusCode != 204 {
-		return fmt.Errorf("failed to request: %d", resp.StatusCode)
+func Stat(client *cookclient.Client, tag string, format string) error {
+	recipe, err := client.Stat(context.Background(), tag)
+	if err != nil {
+		return err
 	}
 
-	if format == "yaml" {
-		y, _ := yaml.Marshal(resp.Data)
-		fmt.Println(string(y))
-	} else {
-		j, _ := json.Marshal(resp.Data)
-		fmt.Println(string(j))
+	Print(recipe, format)
+
+	return nil
+}
+
+func Delete(client *cookclient.Client, tag string) error {
+	return client.Delete(context.Background(), tag)
+}
+
+func List(client *cookclient.Client) error {
+	tags, err := client.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		fmt.Println(tag)
 	}
 
 	return nil
 }
 
-func Upload(servers []*cooklib.Node, tag string, file *os.File) error {
-	return fmt.Errorf("not implemented")
+func PrintMembers(membership *cooklib.Membership) {
+	for _, member := range membership.Members {
+		fmt.Println(member)
+	}
+	for _, learner := range membership.Learners {
+		fmt.Println(learner, "(learner)")
+	}
 }
 
-func Download(servers []*cooklib.Node, tag string, file *os.File) error {
-	return fmt.Errorf("not implemented")
+func Members(client *cookclient.Client) error {
+	members, err := client.Members(context.Background())
+	if err != nil {
+		return err
+	}
+
+	PrintMembers(members)
+
+	return nil
+}
+
+func AddMember(client *cookclient.Client, node *url.URL) error {
+	members, err := client.AddMember(context.Background(), (*cooklib.Node)(node))
+	if err != nil {
+		return err
+	}
+
+	PrintMembers(members)
+
+	return nil
+}
+
+func RemoveMember(client *cookclient.Client, node *url.URL) error {
+	members, err := client.RemoveMember(context.Background(), (*cooklib.Node)(node))
+	if err != nil {
+		return err
+	}
+
+	PrintMembers(members)
+
+	return nil
+}
+
+func TransferLeader(client *cookclient.Client, node *url.URL, format string) error {
+	info, err := client.TransferLeader(context.Background(), (*cooklib.Node)(node))
+	if err != nil {
+		return err
+	}
+
+	Print(info, format)
+
+	return nil
 }
 
 func ConvertServers(servers []*url.URL) []*cooklib.Node {
@@ -81,26 +158,91 @@ func main() {
 	rand.Seed(time.Now().Unix())
 
 	server := kingpin.Flag("server", "Server address.").Default("http://localhost:5790").URLList()
+	format := kingpin.Flag("format", "Output format. yaml or json.").Default("yaml").Enum("yaml", "json")
+	consistency := kingpin.Flag("consistency", "Consistency level of reads. linearizable, bounded or any.").Default("linearizable").Enum("linearizable", "bounded", "any")
+
+	var client *cookclient.Client
+	kingpin.CommandLine.PreAction(func(c *kingpin.ParseContext) error {
+		client = cookclient.NewClient(ConvertServers(*server))
+
+		level, err := cooklib.ParseConsistency(*consistency)
+		if err != nil {
+			return err
+		}
+		client.Consistency = level
+
+		return nil
+	})
 
 	infoCommand := kingpin.Command("info", "Get server information.")
-	infoFormat := infoCommand.Flag("format", "Output format. yaml or json.").Default("yaml").Enum("yaml", "json")
 	infoCommand.Action(func(c *kingpin.ParseContext) error {
-		return Info(ConvertServers(*server), *infoFormat)
+		return Info(client, *format)
 	})
 
 	uploadCommand := kingpin.Command("upload", "Upload file.")
 	uploadTag := uploadCommand.Arg("tag", "Tag name.").Required().String()
 	uploadFile := uploadCommand.Arg("file", "File name.").File()
+	uploadMinSize := uploadCommand.Flag("min-chunk-size", "Minimum size of each chunk.").Default("256KiB").Bytes()
+	uploadAvgSize := uploadCommand.Flag("chunk-size", "Average size of each chunk.").Default("1MiB").Bytes()
+	uploadMaxSize := uploadCommand.Flag("max-chunk-size", "Maximum size of each chunk.").Default("4MiB").Bytes()
+	uploadReplicas := uploadCommand.Flag("replicas", "Number of servers to store each chunk.").Default("2").Int()
 	uploadCommand.Action(func(c *kingpin.ParseContext) error {
-		return Upload(ConvertServers(*server), *uploadTag, *uploadFile)
+		client.MinChunkSize = int(*uploadMinSize)
+		client.ChunkSize = int(*uploadAvgSize)
+		client.MaxChunkSize = int(*uploadMaxSize)
+		client.Replicas = *uploadReplicas
+		return Upload(client, *uploadTag, *uploadFile)
 	})
 
-
 	downloadCommand := kingpin.Command("download", "Download file.")
 	downloadTag := downloadCommand.Arg("tag", "Tag name.").Required().String()
-	downloadFile := downloadCommand.Arg("file", "File name.").File()
+	downloadFile := downloadCommand.Arg("file", "File name.").OpenFile(os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	downloadCommand.Action(func(c *kingpin.ParseContext) error {
-		return Download(ConvertServers(*server), *downloadTag, *downloadFile)
+		return Download(client, *downloadTag, *downloadFile)
+	})
+
+	statCommand := kingpin.Command("stat", "Show recipe of file.")
+	statTag := statCommand.Arg("tag", "Tag name.").Required().String()
+	statCommand.Action(func(c *kingpin.ParseContext) error {
+		return Stat(client, *statTag, *format)
+	})
+
+	deleteCommand := kingpin.Command("delete", "Delete file.")
+	deleteTag := deleteCommand.Arg("tag", "Tag name.").Required().String()
+	deleteCommand.Action(func(c *kingpin.ParseContext) error {
+		return Delete(client, *deleteTag)
+	})
+
+	listCommand := kingpin.Command("list", "List files.")
+	listCommand.Action(func(c *kingpin.ParseContext) error {
+		return List(client)
+	})
+
+	memberCommand := kingpin.Command("member", "Manage cluster members.")
+
+	memberListCommand := memberCommand.Command("list", "List members.")
+	memberListCommand.Action(func(c *kingpin.ParseContext) error {
+		return Members(client)
+	})
+
+	memberAddCommand := memberCommand.Command("add", "Add new member. It joins as a learner and becomes a voter once caught up.")
+	memberAddNode := memberAddCommand.Arg("node", "Node address.").Required().URL()
+	memberAddCommand.Action(func(c *kingpin.ParseContext) error {
+		return AddMember(client, *memberAddNode)
+	})
+
+	memberRemoveCommand := memberCommand.Command("remove", "Remove member.")
+	memberRemoveNode := memberRemoveCommand.Arg("node", "Node address.").Required().URL()
+	memberRemoveCommand.Action(func(c *kingpin.ParseContext) error {
+		return RemoveMember(client, *memberRemoveNode)
+	})
+
+	leaderCommand := kingpin.Command("leader", "Manage cluster leader.")
+
+	leaderTransferCommand := leaderCommand.Command("transfer", "Transfer leadership to another member.")
+	leaderTransferNode := leaderTransferCommand.Arg("node", "Node address.").Required().URL()
+	leaderTransferCommand.Action(func(c *kingpin.ParseContext) error {
+		return TransferLeader(client, *leaderTransferNode, *format)
 	})
 
 	kingpin.Parse()
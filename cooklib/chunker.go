@@ -0,0 +1,120 @@
+package cooklib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+type Chunker interface {
+	Next() ([]byte, error)
+}
+
+type FixedChunker struct {
+	reader io.Reader
+	size   int
+}
+
+func NewFixedChunker(reader io.Reader, size int) *FixedChunker {
+	return &FixedChunker{reader, size}
+}
+
+func (c *FixedChunker) Next() ([]byte, error) {
+	buf := make([]byte, c.size)
+
+	n, err := io.ReadFull(c.reader, buf)
+	if err == io.ErrUnexpectedEOF {
+		return buf[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+var (
+	gearTable = func() [256]uint64 {
+		var table [256]uint64
+
+		x := uint64(0x636f6f6b6673)
+		for i := range table {
+			x += 0x9e3779b97f4a7c15
+			z := x
+			z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+			z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+			table[i] = z ^ (z >> 31)
+		}
+
+		return table
+	}()
+)
+
+func cdcMask(n uint) uint64 {
+	if n < 1 || n > 63 {
+		n = 1
+	}
+	return ((uint64(1) << n) - 1) << (64 - n)
+}
+
+type CDCChunker struct {
+	reader *bufio.Reader
+	min    int
+	avg    int
+	max    int
+	maskS  uint64
+	maskL  uint64
+}
+
+func NewCDCChunker(reader io.Reader, min, avg, max int) (*CDCChunker, error) {
+	if min <= 0 || min > avg || avg > max {
+		return nil, fmt.Errorf("invalid chunk size: must be 0 < min <= avg <= max")
+	}
+
+	n := uint(bits.Len(uint(avg)) - 1)
+
+	return &CDCChunker{
+		reader: bufio.NewReaderSize(reader, 64*1024),
+		min:    min,
+		avg:    avg,
+		max:    max,
+		maskS:  cdcMask(n + 1),
+		maskL:  cdcMask(n - 1),
+	}, nil
+}
+
+func (c *CDCChunker) Next() ([]byte, error) {
+	buf := make([]byte, 0, c.avg)
+	var hash uint64
+
+	for len(buf) < c.max {
+		b, err := c.reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, b)
+		hash = (hash << 1) + gearTable[b]
+
+		if len(buf) < c.min {
+			continue
+		}
+
+		mask := c.maskS
+		if len(buf) >= c.avg {
+			mask = c.maskL
+		}
+		if hash&mask == 0 {
+			break
+		}
+	}
+
+	if len(buf) == 0 {
+		return nil, io.EOF
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,86 @@
+package cooklib
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func Test_FixedChunker(t *testing.T) {
+	chunker := NewFixedChunker(bytes.NewReader([]byte("hello world")), 4)
+
+	excepted := []string{"hell", "o wo", "rld"}
+	for _, e := range excepted {
+		chunk, err := chunker.Next()
+		if err != nil {
+			t.Fatalf("failed to read chunk: %s", err.Error())
+		}
+		if string(chunk) != e {
+			t.Errorf("unexcepted chunk: excepted %#v but got %#v", e, string(chunk))
+		}
+	}
+
+	if _, err := chunker.Next(); err != io.EOF {
+		t.Errorf("excepted io.EOF but got %v", err)
+	}
+}
+
+func splitAll(t *testing.T, data []byte) [][]byte {
+	chunker, err := NewCDCChunker(bytes.NewReader(data), 1024, 4096, 16384)
+	if err != nil {
+		t.Fatalf("failed to make chunker: %s", err.Error())
+	}
+
+	chunks := [][]byte{}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		} else if err != nil {
+			t.Fatalf("failed to read chunk: %s", err.Error())
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func Test_CDCChunker(t *testing.T) {
+	if _, err := NewCDCChunker(bytes.NewReader(nil), 4096, 1024, 16384); err == nil {
+		t.Errorf("must reject min size larger than average size")
+	}
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0)).Read(data)
+
+	chunks := splitAll(t, data)
+
+	if joined := bytes.Join(chunks, nil); !bytes.Equal(joined, data) {
+		t.Fatalf("joined chunks must be same as original data")
+	}
+
+	for i, chunk := range chunks {
+		if len(chunk) > 16384 || (len(chunk) < 1024 && i != len(chunks)-1) {
+			t.Errorf("unexcepted chunk size: %d", len(chunk))
+		}
+	}
+
+	modified := append([]byte{}, data[:512*1024]...)
+	modified = append(modified, []byte("hello world")...)
+	modified = append(modified, data[512*1024:]...)
+
+	known := make(map[ChunkID]bool)
+	for _, chunk := range chunks {
+		known[NewChunkID(chunk)] = true
+	}
+
+	added := 0
+	for _, chunk := range splitAll(t, modified) {
+		if !known[NewChunkID(chunk)] {
+			added++
+		}
+	}
+
+	if added > 3 {
+		t.Errorf("too many new chunks after small edit: %d of %d", added, len(chunks))
+	}
+}
@@ -0,0 +1,181 @@
+package cooklib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrNoSuchChunk = fmt.Errorf("no such chunk")
+)
+
+type ChunkStore interface {
+	Put(ChunkID, []byte) error
+	Get(ChunkID) ([]byte, error)
+	Has(ChunkID) bool
+	Delete(ChunkID) error
+	List() ([]ChunkID, error)
+}
+
+type MemoryChunkStore struct {
+	lock   sync.RWMutex
+	chunks map[ChunkID][]byte
+}
+
+func NewMemoryChunkStore() *MemoryChunkStore {
+	return &MemoryChunkStore{chunks: make(map[ChunkID][]byte)}
+}
+
+func (s *MemoryChunkStore) Put(id ChunkID, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.chunks[id] = data
+
+	return nil
+}
+
+func (s *MemoryChunkStore) Get(id ChunkID) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	data, ok := s.chunks[id]
+	if !ok {
+		return nil, ErrNoSuchChunk
+	}
+
+	return data, nil
+}
+
+func (s *MemoryChunkStore) Has(id ChunkID) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.chunks[id]
+	return ok
+}
+
+func (s *MemoryChunkStore) Delete(id ChunkID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.chunks[id]; !ok {
+		return ErrNoSuchChunk
+	}
+	delete(s.chunks, id)
+
+	return nil
+}
+
+func (s *MemoryChunkStore) List() ([]ChunkID, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ids := make([]ChunkID, 0, len(s.chunks))
+	for id := range s.chunks {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+type FileChunkStore struct {
+	dir string
+}
+
+func NewFileChunkStore(dir string) (*FileChunkStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileChunkStore{dir}, nil
+}
+
+func (s *FileChunkStore) path(id ChunkID) string {
+	name := id.String()
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+func (s *FileChunkStore) Put(id ChunkID, data []byte) error {
+	path := s.path(id)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (s *FileChunkStore) Get(id ChunkID) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSuchChunk
+	}
+	return data, err
+}
+
+func (s *FileChunkStore) Has(id ChunkID) bool {
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+func (s *FileChunkStore) Delete(id ChunkID) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNoSuchChunk
+	}
+	return err
+}
+
+func (s *FileChunkStore) List() ([]ChunkID, error) {
+	ids := []ChunkID{}
+
+	dirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if id, err := ParseChunkID(f.Name()); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
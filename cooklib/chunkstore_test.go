@@ -0,0 +1,65 @@
+package cooklib
+
+import (
+	"testing"
+)
+
+func testChunkStore(t *testing.T, store ChunkStore) {
+	data := []byte("hello world")
+	id := NewChunkID(data)
+
+	if store.Has(id) {
+		t.Errorf("store must not have %s yet", id)
+	}
+
+	if _, err := store.Get(id); err != ErrNoSuchChunk {
+		t.Errorf("excepted ErrNoSuchChunk but got %v", err)
+	}
+
+	if err := store.Put(id, data); err != nil {
+		t.Fatalf("failed to put chunk: %s", err.Error())
+	}
+
+	if !store.Has(id) {
+		t.Errorf("store must have %s", id)
+	}
+
+	got, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("failed to get chunk: %s", err.Error())
+	}
+	if string(got) != string(data) {
+		t.Errorf("unexcepted chunk data: excepted %#v but got %#v", string(data), string(got))
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		t.Fatalf("failed to list chunks: %s", err.Error())
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Errorf("unexcepted chunk list: %v", ids)
+	}
+
+	if err := store.Delete(id); err != nil {
+		t.Errorf("failed to delete chunk: %s", err.Error())
+	}
+	if store.Has(id) {
+		t.Errorf("store must not have %s after delete", id)
+	}
+	if err := store.Delete(id); err != ErrNoSuchChunk {
+		t.Errorf("excepted ErrNoSuchChunk but got %v", err)
+	}
+}
+
+func Test_MemoryChunkStore(t *testing.T) {
+	testChunkStore(t, NewMemoryChunkStore())
+}
+
+func Test_FileChunkStore(t *testing.T) {
+	store, err := NewFileChunkStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to make store: %s", err.Error())
+	}
+
+	testChunkStore(t, store)
+}
@@ -0,0 +1,616 @@
+package cooklib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type memoryNetwork struct {
+	nodes map[string]*CookFS
+	down  map[string]bool
+	lock  sync.Mutex
+}
+
+func (n *memoryNetwork) get(from, to *Node) *CookFS {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.down[from.String()] || n.down[to.String()] {
+		return nil
+	}
+	return n.nodes[to.String()]
+}
+
+func (n *memoryNetwork) SetDown(node *Node, down bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.down[node.String()] = down
+}
+
+type memoryHandler struct {
+	network *memoryNetwork
+	self    *Node
+}
+
+func (h memoryHandler) Listen(ctx context.Context, node *Node, c *CookFS) {
+}
+
+func (h memoryHandler) Send(ctx context.Context, req Request) Response {
+	c := h.network.get(h.self, req.Node)
+	if c == nil || ctx.Err() != nil {
+		return Response{StatusCode: 502}
+	}
+
+	var data interface{}
+	if req.Data != nil {
+		raw, err := msgpack.Marshal(req.Data)
+		if err != nil {
+			return Response{StatusCode: 400}
+		}
+		data = NewRequestStruct(req.Path)
+		if err := msgpack.Unmarshal(raw, data); err != nil {
+			return Response{StatusCode: 404}
+		}
+	}
+
+	resp := c.HandleRequest(Request{h.self, req.Path, data, 0})
+
+	raw, err := msgpack.Marshal(resp.Data)
+	if err != nil {
+		return Response{StatusCode: 500}
+	}
+
+	result := NewResponseStruct(req.Path)
+	if resp.StatusCode == 307 {
+		result = &AliveMessage{}
+	}
+	if result == nil {
+		return Response{StatusCode: resp.StatusCode}
+	}
+	if err := msgpack.Unmarshal(raw, result); err != nil {
+		return Response{StatusCode: resp.StatusCode}
+	}
+	return Response{resp.StatusCode, result}
+}
+
+func (h memoryHandler) SendChunk(ctx context.Context, node *Node, chunk Chunk) (*Node, error) {
+	c := h.network.get(h.self, node)
+	if c == nil {
+		return nil, fmt.Errorf("unreachable: %s", node)
+	}
+	if err := c.Chunks.Put(chunk.ID, chunk.Data); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (h memoryHandler) FetchChunk(ctx context.Context, node *Node, id ChunkID) ([]byte, error) {
+	c := h.network.get(h.self, node)
+	if c == nil {
+		return nil, fmt.Errorf("unreachable: %s", node)
+	}
+	return c.Chunks.Get(id)
+}
+
+func (h memoryHandler) HasChunk(ctx context.Context, node *Node, id ChunkID) (bool, error) {
+	c := h.network.get(h.self, node)
+	if c == nil {
+		return false, fmt.Errorf("unreachable: %s", node)
+	}
+	return c.Chunks.Has(id), nil
+}
+
+func (h memoryHandler) DeleteChunk(ctx context.Context, node *Node, id ChunkID) error {
+	c := h.network.get(h.self, node)
+	if c == nil {
+		return fmt.Errorf("unreachable: %s", node)
+	}
+	return c.Chunks.Delete(id)
+}
+
+var testClusterConfig = Config{
+	AliveInterval:    20 * time.Millisecond,
+	AliveTimeout:     100 * time.Millisecond,
+	LeaderDeathTimer: 300 * time.Millisecond,
+	CandidacyWaitMin: 50 * time.Millisecond,
+	CandidacyWaitMax: 300 * time.Millisecond,
+	CandidacyTimeout: 200 * time.Millisecond,
+	PollingWindow:    50 * time.Millisecond,
+	CommitTimeout:    200 * time.Millisecond,
+	RepairInterval:   time.Minute,
+	GCInterval:       time.Minute,
+	GCGracePeriod:    time.Minute,
+
+	SendWorkersNum:     10,
+	PatchRetention:     1024,
+	CheckpointInterval: 256,
+	ReplicationFactor:  2,
+	MaxReadLag:         16,
+}
+
+func newTestCluster(size int) (*memoryNetwork, []*CookFS) {
+	network := &memoryNetwork{nodes: make(map[string]*CookFS), down: make(map[string]bool)}
+
+	all := []*Node{}
+	for i := 0; i < size; i++ {
+		all = append(all, MustParseNode(fmt.Sprintf("http://node%d", i)))
+	}
+
+	cluster := []*CookFS{}
+	for i, self := range all {
+		nodes := append([]*Node{self}, all[:i]...)
+		nodes = append(nodes, all[i+1:]...)
+
+		c := NewCookFS(memoryHandler{network, self}, func() []*Node { return nodes }, testClusterConfig)
+		network.nodes[self.String()] = c
+		cluster = append(cluster, c)
+	}
+
+	return network, cluster
+}
+
+func runTestCluster(ctx context.Context, cluster []*CookFS) {
+	for _, c := range cluster {
+		go c.RunFollower(ctx)
+	}
+}
+
+func startTestCluster(ctx context.Context, size int) (*memoryNetwork, []*CookFS) {
+	network, cluster := newTestCluster(size)
+	runTestCluster(ctx, cluster)
+	return network, cluster
+}
+
+func addTestNode(ctx context.Context, network *memoryNetwork, cluster []*CookFS) *CookFS {
+	self := MustParseNode(fmt.Sprintf("http://node%d", len(cluster)))
+
+	nodes := []*Node{self}
+	for _, c := range cluster {
+		nodes = append(nodes, c.Self())
+	}
+
+	c := NewCookFS(memoryHandler{network, self}, func() []*Node { return nodes }, testClusterConfig)
+
+	network.lock.Lock()
+	network.nodes[self.String()] = c
+	network.lock.Unlock()
+
+	go c.RunFollower(ctx)
+
+	return c
+}
+
+func waitLeader(t *testing.T, cluster []*CookFS, minTerm int64) *CookFS {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var leader *CookFS
+		count := 0
+		for _, c := range cluster {
+			if c.Role() == Leader && c.Term() >= minTerm {
+				leader = c
+				count++
+			}
+		}
+
+		if count == 1 {
+			agreed := true
+			for _, c := range cluster {
+				if c.Leader().String() != leader.Self().String() || c.Term() != leader.Term() {
+					agreed = false
+				}
+			}
+			if agreed {
+				return leader
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("leader was not elected")
+	return nil
+}
+
+func waitApplied(t *testing.T, cluster []*CookFS, tag string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, c := range cluster {
+		for c.RecipeQuery(RecipeQuery{Tag: tag}).StatusCode != 200 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not applied to %s", tag, c.Self())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func Test_Cluster_Election(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network, cluster := startTestCluster(ctx, 3)
+
+	leader := waitLeader(t, cluster, 1)
+
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != nil {
+		t.Fatalf("failed to commit: %s", err.Error())
+	}
+	waitApplied(t, cluster, "/foo")
+
+	network.SetDown(leader.Self(), true)
+
+	rest := []*CookFS{}
+	for _, c := range cluster {
+		if c != leader {
+			rest = append(rest, c)
+		}
+	}
+
+	next := waitLeader(t, rest, leader.Term()+1)
+
+	if _, err := leader.Commit(RecipeListPatch{"/bar": &Recipe{}}, nil); err == nil {
+		t.Errorf("partitioned leader must not commit")
+	}
+
+	network.SetDown(leader.Self(), false)
+
+	waitLeader(t, cluster, next.Term())
+
+	if leader.Role() != Follower {
+		t.Errorf("old leader must be follower but %s", leader.Role())
+	}
+	if leader.Leader().String() != next.Self().String() {
+		t.Errorf("old leader must follow new leader but %s", leader.Leader())
+	}
+	waitApplied(t, []*CookFS{next}, "/foo")
+}
+
+func Test_Cluster_LinearizableRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network, cluster := startTestCluster(ctx, 3)
+
+	leader := waitLeader(t, cluster, 1)
+
+	var follower *CookFS
+	for _, c := range cluster {
+		if c != leader {
+			follower = c
+		}
+	}
+
+	if _, err := leader.Commit(RecipeListPatch{"/bar": &Recipe{}}, nil); err != nil {
+		t.Fatalf("failed to commit: %s", err.Error())
+	}
+	waitApplied(t, cluster, "/bar")
+
+	network.SetDown(follower.Self(), true)
+
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != nil {
+		t.Fatalf("failed to commit: %s", err.Error())
+	}
+
+	if resp := follower.RecipeQuery(RecipeQuery{Tag: "/foo"}); resp.StatusCode != 503 {
+		t.Errorf("partitioned follower must refuse read: %d", resp.StatusCode)
+	}
+
+	network.SetDown(follower.Self(), false)
+
+	if resp := follower.RecipeQuery(RecipeQuery{Tag: "/foo"}); resp.StatusCode != 200 {
+		t.Errorf("follower must read committed recipe: %d", resp.StatusCode)
+	}
+	if resp := follower.RecipeTags(RecipeListQuery{}); resp.StatusCode != 200 || len(resp.Data.([]string)) != 2 {
+		t.Errorf("unexcepted tags: %d %v", resp.StatusCode, resp.Data)
+	}
+}
+
+func Test_Cluster_Transfer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, cluster := startTestCluster(ctx, 3)
+
+	leader := waitLeader(t, cluster, 1)
+
+	var target *CookFS
+	for _, c := range cluster {
+		if c != leader {
+			target = c
+		}
+	}
+
+	if err := leader.TransferLeadership(MustParseNode("http://unknown")); err != ErrNotMember {
+		t.Errorf("must reject transfer to non-member: %v", err)
+	}
+
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != nil {
+		t.Fatalf("failed to commit: %s", err.Error())
+	}
+
+	term := leader.Term()
+
+	if err := leader.TransferLeadership(target.Self()); err != nil {
+		t.Fatalf("failed to transfer leadership: %s", err.Error())
+	}
+	if leader.Role() != Follower {
+		t.Errorf("old leader must step down before new election: %s", leader.Role())
+	}
+
+	if next := waitLeader(t, cluster, term+1); next != target {
+		t.Errorf("leadership must move to %s but %s", target.Self(), next.Self())
+	}
+	waitApplied(t, []*CookFS{target}, "/foo")
+}
+
+func Test_Cluster_Priority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network, cluster := newTestCluster(3)
+	prior := cluster[2]
+	prior.Config.Priority = 1
+
+	network.SetDown(prior.Self(), true)
+	runTestCluster(ctx, cluster)
+
+	leader := waitLeader(t, cluster[:2], 1)
+
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != nil {
+		t.Fatalf("failed to commit: %s", err.Error())
+	}
+
+	network.SetDown(prior.Self(), false)
+
+	if next := waitLeader(t, cluster, leader.Term()+1); next != prior {
+		t.Errorf("leadership must move to prior node %s but %s", prior.Self(), next.Self())
+	}
+	waitApplied(t, []*CookFS{prior}, "/foo")
+
+	if resp := prior.TransferRequest(TransferRequest{leader.Self(), false, true}); resp.StatusCode != 409 {
+		t.Errorf("must reject handoff to lower priority node: %d", resp.StatusCode)
+	}
+
+	term := prior.Term()
+
+	if err := prior.TransferLeadership(leader.Self()); err != nil {
+		t.Fatalf("operator must be able to transfer to lower priority node: %s", err.Error())
+	}
+
+	if next := waitLeader(t, cluster, term+2); next != prior {
+		t.Errorf("leadership must be handed back to prior node %s but %s", prior.Self(), next.Self())
+	}
+}
+
+func Test_Cluster_Learner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network, cluster := startTestCluster(ctx, 3)
+
+	leader := waitLeader(t, cluster, 1)
+
+	learner := addTestNode(ctx, network, cluster)
+	network.SetDown(learner.Self(), true)
+
+	membership, err := leader.ChangeMember(learner.Self(), false)
+	if err != nil {
+		t.Fatalf("failed to add learner: %s", err.Error())
+	}
+	if len(membership.Members) != 3 || len(membership.Learners) != 1 {
+		t.Fatalf("new node must join as learner: %v", membership)
+	}
+
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != nil {
+		t.Fatalf("unreachable learner must not affect quorum: %s", err.Error())
+	}
+
+	time.Sleep(testClusterConfig.LeaderDeathTimer)
+	if len(leader.Learners()) != 1 {
+		t.Errorf("unreachable learner must not be promoted")
+	}
+
+	network.SetDown(learner.Self(), false)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(leader.Learners()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("learner was not promoted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !leader.IsMember(learner.Self()) {
+		t.Errorf("promoted learner must be member: %v", leader.Membership())
+	}
+	waitApplied(t, []*CookFS{learner}, "/foo")
+}
+
+func Test_Cluster_Repair(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network, cluster := startTestCluster(ctx, 4)
+
+	leader := waitLeader(t, cluster, 1)
+
+	others := []*CookFS{}
+	for _, c := range cluster {
+		if c != leader {
+			others = append(others, c)
+		}
+	}
+	lost, holder := others[0], others[1]
+
+	data := []byte("hello world")
+	chunk := NewChunkID(data)
+
+	patch := make(ChunkHoldersPatch)
+	for _, c := range []*CookFS{lost, holder} {
+		c.Chunks.Put(chunk, data)
+		patch.AddChunk(c.Self(), chunk)
+	}
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{1, []ChunkID{chunk}}}, patch); err != nil {
+		t.Fatalf("failed to commit holders: %s", err.Error())
+	}
+	waitApplied(t, cluster, "/foo")
+
+	network.SetDown(lost.Self(), true)
+
+	if alive := leader.AliveNodes(ctx); len(alive) != 3 {
+		t.Errorf("unexcepted number of alive nodes: %d", len(alive))
+	}
+
+	if err := leader.Repair(ctx); err != nil {
+		t.Fatalf("failed to repair: %s", err.Error())
+	}
+
+	var copied *CookFS
+	for _, c := range []*CookFS{leader, others[2]} {
+		if c.Chunks.Has(chunk) {
+			copied = c
+		}
+	}
+	if copied == nil {
+		t.Fatalf("chunk must be copied to a new node")
+	}
+
+	leader.lock.Lock()
+	holders := append([]*Node{}, leader.state.ChunkHolders[chunk]...)
+	leader.lock.Unlock()
+
+	found := false
+	for _, node := range holders {
+		if node.String() == copied.Self().String() {
+			found = true
+		}
+	}
+	if !found || len(holders) != 3 {
+		t.Errorf("new holder must be committed: %v", holders)
+	}
+}
+
+func Test_Cluster_Forward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network, cluster := startTestCluster(ctx, 3)
+
+	leader := waitLeader(t, cluster, 1)
+
+	var follower *CookFS
+	for _, c := range cluster {
+		if c != leader {
+			follower = c
+		}
+	}
+
+	if resp := follower.CommitRequest(CommitRequest{Recipes: RecipeListPatch{"/foo": &Recipe{}}}); resp.StatusCode != 200 {
+		t.Fatalf("failed to commit through follower: %d", resp.StatusCode)
+	} else if _, ok := resp.Data.(*PatchID); !ok {
+		t.Errorf("unexcepted response of forwarded commit: %#v", resp.Data)
+	}
+	waitApplied(t, cluster, "/foo")
+
+	node := addTestNode(ctx, network, cluster)
+	if resp := follower.MemberRequest(MemberRequest{node.Self(), false, false}); resp.StatusCode != 200 {
+		t.Fatalf("failed to change membership through follower: %d", resp.StatusCode)
+	} else if membership, ok := resp.Data.(*Membership); !ok || len(membership.Members)+len(membership.Learners) != 4 {
+		t.Errorf("unexcepted response of forwarded member change: %#v", resp.Data)
+	}
+	if !leader.IsMember(node.Self()) && len(leader.Learners()) != 1 {
+		t.Errorf("new node must join cluster: %v", leader.Membership())
+	}
+
+	for _, resp := range []Response{
+		follower.CommitRequest(CommitRequest{Recipes: RecipeListPatch{"/bar": &Recipe{}}, Forwarded: true}),
+		follower.MemberRequest(MemberRequest{node.Self(), true, true}),
+	} {
+		if resp.StatusCode != 307 {
+			t.Errorf("must redirect already forwarded request: %d", resp.StatusCode)
+		} else if alive, ok := resp.Data.(AliveMessage); !ok || alive.Leader.String() != leader.Self().String() {
+			t.Errorf("redirect must point to leader: %#v", resp.Data)
+		}
+	}
+}
+
+func testCatchUp(ctx context.Context, t *testing.T, retention int) (*CookFS, Patch) {
+	t.Helper()
+
+	network, cluster := newTestCluster(3)
+	for _, c := range cluster {
+		c.Config.PatchRetention = retention
+	}
+	runTestCluster(ctx, cluster)
+
+	leader := waitLeader(t, cluster, 1)
+
+	if _, err := leader.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != nil {
+		t.Fatalf("failed to commit: %s", err.Error())
+	}
+	waitApplied(t, cluster, "/foo")
+
+	var lagging *CookFS
+	for _, c := range cluster {
+		if c != leader {
+			lagging = c
+		}
+	}
+	network.SetDown(lagging.Self(), true)
+
+	var first Patch
+	for i := 0; i < 5; i++ {
+		patch, err := leader.Commit(RecipeListPatch{fmt.Sprintf("/bar%d", i): &Recipe{}}, nil)
+		if err != nil {
+			t.Fatalf("failed to commit: %s", err.Error())
+		}
+		if i == 0 {
+			first = patch
+		}
+	}
+
+	network.SetDown(lagging.Self(), false)
+	waitApplied(t, []*CookFS{lagging}, "/bar4")
+
+	return lagging, first
+}
+
+func Test_Cluster_CatchUp_Replay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	follower, first := testCatchUp(ctx, t, 1024)
+
+	follower.lock.Lock()
+	defer follower.lock.Unlock()
+
+	if !follower.chain.Has(first.ID) {
+		t.Errorf("lagging follower must catch up by replaying journal")
+	}
+}
+
+func Test_Cluster_CatchUp_Snapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	follower, first := testCatchUp(ctx, t, 2)
+
+	follower.lock.Lock()
+	defer follower.lock.Unlock()
+
+	if follower.chain.Has(first.ID) {
+		t.Errorf("lagging follower must fall back to snapshot after compaction")
+	}
+	if _, ok := follower.state.Recipes["/bar0"]; !ok {
+		t.Errorf("snapshot must include compacted patches")
+	}
+}
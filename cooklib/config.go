@@ -1,19 +1,31 @@
 package cooklib
 
 import (
+	"fmt"
 	"time"
 )
 
 type Config struct {
-	AliveInterval    time.Duration
-	AliveTimeout     time.Duration
-	LeaderDeathTimer time.Duration
-	CandidacyWaitMin time.Duration
-	CandidacyWaitMax time.Duration
-	CandidacyTimeout time.Duration
-	PollingWindow    time.Duration
-
-	SendWorkersNum int
+	AliveInterval    time.Duration `yaml:"alive_interval"`
+	AliveTimeout     time.Duration `yaml:"alive_timeout"`
+	LeaderDeathTimer time.Duration `yaml:"leader_death_timer"`
+	CandidacyWaitMin time.Duration `yaml:"candidacy_wait_min"`
+	CandidacyWaitMax time.Duration `yaml:"candidacy_wait_max"`
+	CandidacyTimeout time.Duration `yaml:"candidacy_timeout"`
+	PollingWindow    time.Duration `yaml:"polling_window"`
+	CommitTimeout    time.Duration `yaml:"commit_timeout"`
+	RepairInterval   time.Duration `yaml:"repair_interval"`
+	GCInterval       time.Duration `yaml:"gc_interval"`
+	GCGracePeriod    time.Duration `yaml:"gc_grace_period"`
+
+	SendWorkersNum     int `yaml:"send_workers_num"`
+	PatchRetention     int `yaml:"patch_retention"`
+	CheckpointInterval int `yaml:"checkpoint_interval"`
+	ReplicationFactor  int `yaml:"replication_factor"`
+	MaxReadLag         int `yaml:"max_read_lag"`
+	Priority           int `yaml:"priority"`
+
+	NeverLeader bool `yaml:"never_leader"`
 }
 
 var (
@@ -21,9 +33,67 @@ var (
 		AliveInterval:    100 * time.Millisecond,
 		AliveTimeout:     500 * time.Millisecond,
 		LeaderDeathTimer: 1500 * time.Millisecond,
+		CandidacyWaitMin: 150 * time.Millisecond,
+		CandidacyWaitMax: 1500 * time.Millisecond,
 		CandidacyTimeout: 1000 * time.Millisecond,
 		PollingWindow:    500 * time.Millisecond,
+		CommitTimeout:    1000 * time.Millisecond,
+		RepairInterval:   10 * time.Second,
+		GCInterval:       1 * time.Minute,
+		GCGracePeriod:    10 * time.Minute,
 
-		SendWorkersNum: 10,
+		SendWorkersNum:     10,
+		PatchRetention:     1024,
+		CheckpointInterval: 256,
+		ReplicationFactor:  2,
+		MaxReadLag:         16,
 	}
 )
+
+func (c Config) Validate() error {
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"AliveInterval", c.AliveInterval},
+		{"AliveTimeout", c.AliveTimeout},
+		{"LeaderDeathTimer", c.LeaderDeathTimer},
+		{"CandidacyTimeout", c.CandidacyTimeout},
+		{"PollingWindow", c.PollingWindow},
+		{"CommitTimeout", c.CommitTimeout},
+		{"RepairInterval", c.RepairInterval},
+		{"GCInterval", c.GCInterval},
+	}
+	for _, d := range positive {
+		if d.value <= 0 {
+			return fmt.Errorf("%s must be positive: %s", d.name, d.value)
+		}
+	}
+
+	switch {
+	case c.AliveInterval >= c.LeaderDeathTimer:
+		return fmt.Errorf("AliveInterval (%s) must be shorter than LeaderDeathTimer (%s)", c.AliveInterval, c.LeaderDeathTimer)
+	case c.AliveTimeout > c.LeaderDeathTimer:
+		return fmt.Errorf("AliveTimeout (%s) must not be longer than LeaderDeathTimer (%s)", c.AliveTimeout, c.LeaderDeathTimer)
+	case c.CandidacyWaitMin < 0 || c.CandidacyWaitMin > c.CandidacyWaitMax:
+		return fmt.Errorf("CandidacyWaitMin (%s) must be between 0 and CandidacyWaitMax (%s)", c.CandidacyWaitMin, c.CandidacyWaitMax)
+	case c.PollingWindow >= c.CandidacyTimeout:
+		return fmt.Errorf("PollingWindow (%s) must be shorter than CandidacyTimeout (%s)", c.PollingWindow, c.CandidacyTimeout)
+	case c.GCGracePeriod < 0:
+		return fmt.Errorf("GCGracePeriod must not be negative: %s", c.GCGracePeriod)
+	case c.SendWorkersNum < 1:
+		return fmt.Errorf("SendWorkersNum must be at least 1: %d", c.SendWorkersNum)
+	case c.PatchRetention < 0:
+		return fmt.Errorf("PatchRetention must not be negative: %d", c.PatchRetention)
+	case c.CheckpointInterval < 1:
+		return fmt.Errorf("CheckpointInterval must be at least 1: %d", c.CheckpointInterval)
+	case c.ReplicationFactor < 1:
+		return fmt.Errorf("ReplicationFactor must be at least 1: %d", c.ReplicationFactor)
+	case c.Priority < 0:
+		return fmt.Errorf("Priority must not be negative: %d", c.Priority)
+	case c.MaxReadLag < 0:
+		return fmt.Errorf("MaxReadLag must not be negative: %d", c.MaxReadLag)
+	}
+
+	return nil
+}
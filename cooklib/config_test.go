@@ -0,0 +1,31 @@
+package cooklib
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Config_Validate(t *testing.T) {
+	if err := DefaultConfig.Validate(); err != nil {
+		t.Errorf("default config must be valid: %s", err.Error())
+	}
+
+	c := DefaultConfig
+	c.AliveInterval = c.LeaderDeathTimer
+	if c.Validate() == nil {
+		t.Errorf("must reject AliveInterval longer than LeaderDeathTimer")
+	}
+
+	c = DefaultConfig
+	c.CandidacyWaitMin = 200 * time.Millisecond
+	c.CandidacyWaitMax = 100 * time.Millisecond
+	if c.Validate() == nil {
+		t.Errorf("must reject CandidacyWaitMin longer than CandidacyWaitMax")
+	}
+
+	c = DefaultConfig
+	c.SendWorkersNum = 0
+	if c.Validate() == nil {
+		t.Errorf("must reject zero SendWorkersNum")
+	}
+}
@@ -0,0 +1,238 @@
+package cooklib
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (c *CookFS) storeChunk(id ChunkID, data []byte) error {
+	c.touchedLock.Lock()
+	now := time.Now()
+	c.touched[id] = now
+	for k, t := range c.touched {
+		if now.Sub(t) > c.Config.GCGracePeriod {
+			delete(c.touched, k)
+		}
+	}
+	c.touchedLock.Unlock()
+
+	if c.Chunks.Has(id) {
+		return nil
+	}
+
+	return c.Chunks.Put(id, data)
+}
+
+func (c *CookFS) recentlyTouched(id ChunkID) bool {
+	c.touchedLock.Lock()
+	defer c.touchedLock.Unlock()
+
+	t, ok := c.touched[id]
+	return ok && time.Since(t) < c.Config.GCGracePeriod
+}
+
+func referencedChunks(state *State) map[ChunkID]bool {
+	referenced := make(map[ChunkID]bool)
+	for _, recipe := range state.Recipes {
+		for _, chunk := range recipe.Chunks {
+			referenced[chunk] = true
+		}
+	}
+	return referenced
+}
+
+func (c *CookFS) DeleteChunk(id ChunkID) Response {
+	c.lock.Lock()
+	referenced := referencedChunks(c.state)[id]
+	c.lock.Unlock()
+
+	if referenced || c.recentlyTouched(id) {
+		return Response{StatusCode: 409}
+	}
+
+	if err := c.Chunks.Delete(id); err == ErrNoSuchChunk {
+		return Response{StatusCode: 404}
+	} else if err != nil {
+		return Response{StatusCode: 500}
+	}
+
+	return Response{StatusCode: 200}
+}
+
+func (c *CookFS) markGarbage(garbage map[ChunkID]time.Time) (ChunkHoldersPatch, map[ChunkID][]*Node) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	referenced := referencedChunks(c.state)
+
+	for chunk := range garbage {
+		if _, ok := c.state.ChunkHolders[chunk]; !ok || referenced[chunk] {
+			delete(garbage, chunk)
+		}
+	}
+
+	for chunk := range c.state.ChunkHolders {
+		if _, ok := garbage[chunk]; !ok && !referenced[chunk] {
+			garbage[chunk] = now
+		}
+	}
+
+	patch := make(ChunkHoldersPatch)
+	sweep := make(map[ChunkID][]*Node)
+	for chunk, since := range garbage {
+		if now.Sub(since) < c.Config.GCGracePeriod {
+			continue
+		}
+
+		for _, node := range c.state.ChunkHolders[chunk] {
+			patch.DelChunk(node, chunk)
+		}
+		sweep[chunk] = append([]*Node{}, c.state.ChunkHolders[chunk]...)
+	}
+
+	return patch, sweep
+}
+
+func (c *CookFS) CollectGarbage(ctx context.Context, garbage map[ChunkID]time.Time) error {
+	patch, sweep := c.markGarbage(garbage)
+	if len(sweep) == 0 {
+		return nil
+	}
+
+	_, err := c.commit(Patch{Chunks: patch}, func(state *State) error {
+		referenced := referencedChunks(state)
+		for chunk := range sweep {
+			if referenced[chunk] {
+				return fmt.Errorf("chunk %s is referenced again", chunk)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for chunk, holders := range sweep {
+		delete(garbage, chunk)
+
+		for _, node := range holders {
+			ctx, cancel := context.WithTimeout(ctx, c.Config.CommitTimeout)
+			err := c.Handler.DeleteChunk(ctx, node, chunk)
+			cancel()
+
+			if err != nil {
+				fmt.Println("failed to delete chunk", chunk, "from", node, ":", err.Error())
+			}
+		}
+	}
+
+	fmt.Println("collected", len(sweep), "chunks")
+
+	return nil
+}
+
+func (c *CookFS) markOrphans(orphans map[ChunkID]time.Time) ([]ChunkID, error) {
+	stored, err := c.Chunks.List()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	holding := make(map[ChunkID]bool)
+	for chunk, holders := range c.state.ChunkHolders {
+		for _, node := range holders {
+			if node.String() == c.self.String() {
+				holding[chunk] = true
+			}
+		}
+	}
+	c.lock.Unlock()
+
+	now := time.Now()
+	found := make(map[ChunkID]bool)
+	sweep := []ChunkID{}
+
+	for _, chunk := range stored {
+		found[chunk] = true
+
+		if holding[chunk] || c.recentlyTouched(chunk) {
+			delete(orphans, chunk)
+			continue
+		}
+
+		if since, ok := orphans[chunk]; !ok {
+			orphans[chunk] = now
+		} else if now.Sub(since) >= c.Config.GCGracePeriod {
+			sweep = append(sweep, chunk)
+		}
+	}
+
+	for chunk := range orphans {
+		if !found[chunk] {
+			delete(orphans, chunk)
+		}
+	}
+
+	return sweep, nil
+}
+
+func (c *CookFS) CollectOrphans(orphans map[ChunkID]time.Time) error {
+	sweep, err := c.markOrphans(orphans)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range sweep {
+		delete(orphans, chunk)
+
+		if err := c.Chunks.Delete(chunk); err != nil && err != ErrNoSuchChunk {
+			fmt.Println("failed to delete orphan chunk", chunk, ":", err.Error())
+		}
+	}
+
+	if len(sweep) > 0 {
+		fmt.Println("collected", len(sweep), "orphan chunks")
+	}
+
+	return nil
+}
+
+func (c *CookFS) RunOrphanGC(ctx context.Context) {
+	orphans := make(map[ChunkID]time.Time)
+
+	ticker := time.NewTicker(c.Config.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.CollectOrphans(orphans); err != nil {
+				fmt.Println("failed to collect orphan chunks:", err.Error())
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *CookFS) RunGC(ctx context.Context) {
+	garbage := make(map[ChunkID]time.Time)
+
+	ticker := time.NewTicker(c.Config.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.CollectGarbage(ctx, garbage); err != nil {
+				fmt.Println("failed to collect garbage:", err.Error())
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
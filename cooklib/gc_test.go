@@ -0,0 +1,102 @@
+package cooklib
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_markGarbage(t *testing.T) {
+	config := DefaultConfig
+	config.GCGracePeriod = time.Hour
+
+	node := MustParseNode("http://example.com")
+	c := NewCookFS(nil, func() []*Node { return []*Node{node} }, config)
+
+	used := NewChunkID([]byte("used"))
+	unused := NewChunkID([]byte("unused"))
+	old := NewChunkID([]byte("old"))
+
+	c.state.Recipes = RecipeList{"/foo": Recipe{4, []ChunkID{used}}}
+	c.state.ChunkHolders = ChunkHolders{
+		used:   []*Node{node},
+		unused: []*Node{node},
+		old:    []*Node{node},
+	}
+
+	garbage := map[ChunkID]time.Time{
+		used: time.Now().Add(-2 * time.Hour),
+		old:  time.Now().Add(-2 * time.Hour),
+	}
+
+	patch, sweep := c.markGarbage(garbage)
+
+	if _, ok := garbage[used]; ok {
+		t.Errorf("referenced chunk must not be marked")
+	}
+	if _, ok := garbage[unused]; !ok {
+		t.Errorf("unreferenced chunk must be marked")
+	}
+
+	if len(sweep) != 1 || len(sweep[old]) != 1 {
+		t.Errorf("only chunk that passed grace period must be swept: %v", sweep)
+	}
+	if len(patch) != 1 || len(patch[patch.key(node)].Del) != 1 {
+		t.Errorf("unexcepted patch: %v", patch)
+	}
+
+	if c.storeChunk(unused, []byte("unused")); c.DeleteChunk(unused).StatusCode != 409 {
+		t.Errorf("must not delete recently uploaded chunk")
+	}
+}
+
+func Test_CollectOrphans(t *testing.T) {
+	config := DefaultConfig
+	config.GCGracePeriod = time.Hour
+
+	node := MustParseNode("http://example.com")
+	other := MustParseNode("http://other.com")
+	c := NewCookFS(nil, func() []*Node { return []*Node{node, other} }, config)
+
+	held := NewChunkID([]byte("held"))
+	orphan := NewChunkID([]byte("orphan"))
+	elsewhere := NewChunkID([]byte("elsewhere"))
+	recent := NewChunkID([]byte("recent"))
+
+	c.Chunks.Put(held, []byte("held"))
+	c.Chunks.Put(orphan, []byte("orphan"))
+	c.Chunks.Put(elsewhere, []byte("elsewhere"))
+	c.storeChunk(recent, []byte("recent"))
+
+	c.state.ChunkHolders = ChunkHolders{
+		held:      []*Node{node},
+		elsewhere: []*Node{other},
+	}
+
+	orphans := map[ChunkID]time.Time{}
+	if err := c.CollectOrphans(orphans); err != nil {
+		t.Fatalf("failed to collect orphans: %s", err.Error())
+	}
+	if len(orphans) != 2 || !c.Chunks.Has(orphan) {
+		t.Errorf("orphan chunk must be marked but kept until grace period: %v", orphans)
+	}
+
+	for chunk := range orphans {
+		orphans[chunk] = time.Now().Add(-2 * time.Hour)
+	}
+	if err := c.CollectOrphans(orphans); err != nil {
+		t.Fatalf("failed to collect orphans: %s", err.Error())
+	}
+
+	if c.Chunks.Has(orphan) || c.Chunks.Has(elsewhere) {
+		t.Errorf("chunks not held by this node must be swept after grace period")
+	}
+	if !c.Chunks.Has(held) {
+		t.Errorf("chunk held by this node must not be swept")
+	}
+	if !c.Chunks.Has(recent) {
+		t.Errorf("recently stored chunk must not be swept")
+	}
+	if len(orphans) != 0 {
+		t.Errorf("swept chunks must be forgotten: %v", orphans)
+	}
+}
@@ -20,31 +20,154 @@ type Response struct {
 type CommunicationHandler interface {
 	Listen(context.Context, *Node, *CookFS)
 	Send(context.Context, Request) Response
+	SendChunk(context.Context, *Node, Chunk) (*Node, error)
+	FetchChunk(context.Context, *Node, ChunkID) ([]byte, error)
+	HasChunk(context.Context, *Node, ChunkID) (bool, error)
+	DeleteChunk(context.Context, *Node, ChunkID) error
 }
 
 type AliveMessage struct {
-	Leader  *Node   `json:"leader"`
-	Term    int64   `json:"term"`
-	PatchID PatchID `json:"patch_id"`
+	Leader   *Node   `json:"leader"`
+	Term     int64   `json:"term"`
+	PatchID  PatchID `json:"patch_id"`
+	Index    int64   `json:"index"`
+	Priority int     `json:"priority"`
+}
+
+type Vote struct {
+	Term int64 `json:"term"`
+	Node *Node `json:"node"`
 }
 
 type PollRequest struct {
-	Node    *Node   `json:"node"`
-	Term    int64   `json:"term"`
+	Node      *Node `json:"node"`
+	Term      int64 `json:"term"`
+	LastTerm  int64 `json:"last_term"`
+	LastIndex int64 `json:"last_index"`
+	Priority  int   `json:"priority"`
+	Transfer  bool  `json:"transfer"`
+}
+
+type ReadIndex struct {
 	PatchID PatchID `json:"patch_id"`
+	Index   int64   `json:"index"`
+}
+
+type Chunk struct {
+	ID   ChunkID `json:"id"`
+	Data []byte  `json:"data"`
+}
+
+type CommitRequest struct {
+	Recipes   RecipeListPatch   `json:"recipes"`
+	Chunks    ChunkHoldersPatch `json:"chunks"`
+	Forwarded bool              `json:"forwarded"`
+}
+
+type MemberRequest struct {
+	Node      *Node `json:"node"`
+	Remove    bool  `json:"remove"`
+	Forwarded bool  `json:"forwarded"`
+}
+
+type TransferRequest struct {
+	Node      *Node `json:"node"`
+	Forwarded bool  `json:"forwarded"`
+	Handoff   bool  `json:"handoff"`
+}
+
+type Membership struct {
+	Members  []*Node `json:"members"`
+	Learners []*Node `json:"learners"`
+}
+
+type ReplicateRequest struct {
+	Chunk   ChunkID `json:"chunk"`
+	Sources []*Node `json:"sources"`
+}
+
+type RecipeQuery struct {
+	Tag         string      `json:"tag"`
+	Consistency Consistency `json:"consistency"`
+}
+
+type RecipeListQuery struct {
+	Consistency Consistency `json:"consistency"`
+}
+
+type RecipeInfo struct {
+	Tag     string       `json:"tag"`
+	Recipe  Recipe       `json:"recipe"`
+	Holders ChunkHolders `json:"holders"`
+	Lag     int64        `json:"lag"`
 }
 
 func NewRequestStruct(path string) interface{} {
 	switch path {
-	case "/term":
+	case "/term", "/term/timeout":
 		return &AliveMessage{}
 
-	case "/term/poll":
+	case "/term/poll", "/term/prevote":
 		return &PollRequest{}
 
+	case "/term/transfer":
+		return &TransferRequest{}
+
 	case "/journal":
 		return &Patch{}
 
+	case "/journal/since":
+		return &PatchID{}
+
+	case "/commit":
+		return &CommitRequest{}
+
+	case "/recipe":
+		return &RecipeQuery{}
+
+	case "/recipe/list":
+		return &RecipeListQuery{}
+
+	case "/replicate":
+		return &ReplicateRequest{}
+
+	case "/member":
+		return &MemberRequest{}
+
+	default:
+		return nil
+	}
+}
+
+func NewResponseStruct(path string) interface{} {
+	switch path {
+	case "/term", "/term/transfer", "/journal":
+		return &AliveMessage{}
+
+	case "/journal/since":
+		return &[]Patch{}
+
+	case "/journal/index":
+		return &ReadIndex{}
+
+	case "/state":
+		return &State{}
+
+	case "/commit":
+		return &PatchID{}
+
+	case "/recipe":
+		return &RecipeInfo{}
+
+	case "/recipe/list":
+		return &[]string{}
+
+	case "/replicate":
+		return &Node{}
+
+	case "/member", "/member/list":
+		return &Membership{}
+
 	default:
 		return nil
 	}
@@ -0,0 +1,208 @@
+package cooklib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type journalRecord struct {
+	Patch  *Patch   `msgpack:",omitempty"`
+	Commit *PatchID `msgpack:",omitempty"`
+	Term   *int64   `msgpack:",omitempty"`
+	Vote   *Vote    `msgpack:",omitempty"`
+}
+
+type Journal struct {
+	dir  string
+	file *os.File
+	lock sync.Mutex
+}
+
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	j := &Journal{dir: dir}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+func (j *Journal) path(name string) string {
+	return filepath.Join(j.dir, name)
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.path("journal"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	j.file = f
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.file.Close()
+}
+
+func encodeRecord(record journalRecord) ([]byte, error) {
+	data, err := msgpack.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	return append(buf, data...), nil
+}
+
+func (j *Journal) append(record journalRecord, sync bool) error {
+	buf, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if _, err := j.file.Write(buf); err != nil {
+		return err
+	}
+
+	if sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+func (j *Journal) AppendPatch(patch Patch) error {
+	return j.append(journalRecord{Patch: &patch}, true)
+}
+
+func (j *Journal) AppendCommit(id PatchID) error {
+	return j.append(journalRecord{Commit: &id}, false)
+}
+
+func (j *Journal) AppendTerm(term int64, vote Vote) error {
+	return j.append(journalRecord{Term: &term, Vote: &vote}, true)
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (j *Journal) Checkpoint(state *State, term int64, vote Vote, pending []Patch) error {
+	encoded, err := msgpack.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	records := []journalRecord{{Term: &term, Vote: &vote}}
+	for i := range pending {
+		records = append(records, journalRecord{Patch: &pending[i]})
+	}
+
+	journal := []byte{}
+	for _, r := range records {
+		buf, err := encodeRecord(r)
+		if err != nil {
+			return err
+		}
+		journal = append(journal, buf...)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if err := writeFileSync(j.path("state"), encoded); err != nil {
+		return err
+	}
+
+	if err := writeFileSync(j.path("journal"), journal); err != nil {
+		return err
+	}
+
+	j.file.Close()
+	return j.open()
+}
+
+func (j *Journal) load() (*State, []journalRecord, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	state := NewState()
+
+	raw, err := ioutil.ReadFile(j.path("state"))
+	if err == nil {
+		if err := msgpack.Unmarshal(raw, state); err != nil {
+			return nil, nil, fmt.Errorf("broken checkpoint: %s", err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	raw, err = ioutil.ReadFile(j.path("journal"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := []journalRecord{}
+	offset := 0
+	for offset+4 <= len(raw) {
+		size := int(binary.BigEndian.Uint32(raw[offset:]))
+		if offset+4+size > len(raw) {
+			break
+		}
+
+		var r journalRecord
+		if err := msgpack.Unmarshal(raw[offset+4:offset+4+size], &r); err != nil {
+			return nil, nil, fmt.Errorf("broken journal: record at %d: %s", offset, err.Error())
+		}
+
+		records = append(records, r)
+		offset += 4 + size
+	}
+
+	if offset < len(raw) {
+		fmt.Println("discard broken journal tail of", len(raw)-offset, "bytes")
+		if err := j.file.Truncate(int64(offset)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return state, records, nil
+}
@@ -0,0 +1,264 @@
+package cooklib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func Test_Journal(t *testing.T) {
+	dir := t.TempDir()
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatalf("failed to open journal: %s", err.Error())
+	}
+
+	var chain PatchChain
+	state := NewState()
+	p1, _ := chain.New(1, RecipeListPatch{"/foo": &Recipe{1, []ChunkID{NewChunkID([]byte("a"))}}}, nil)
+	p2, _ := chain.New(1, RecipeListPatch{"/bar": &Recipe{1, []ChunkID{NewChunkID([]byte("b"))}}}, nil)
+	chain.ApplyTo(state, p1.ID)
+
+	for _, err := range []error{j.AppendTerm(3, Vote{3, nodes()[0]}), j.AppendPatch(p1), j.AppendPatch(p2), j.AppendCommit(p1.ID)} {
+		if err != nil {
+			t.Fatalf("failed to write journal: %s", err.Error())
+		}
+	}
+	j.Close()
+
+	f, _ := os.OpenFile(filepath.Join(dir, "journal"), os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+
+	j, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatalf("failed to open journal: %s", err.Error())
+	}
+
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.Journal = j
+	if err := c.Restore(); err != nil {
+		t.Fatalf("failed to restore: %s", err.Error())
+	}
+
+	if c.term != 3 {
+		t.Errorf("unexcepted term: excepted 3 but got %d", c.term)
+	}
+	if c.state.ID != state.ID {
+		t.Errorf("unexcepted state: excepted %s but got %s", state, c.state)
+	}
+	if c.vote.Term != 3 || c.vote.Node.String() != nodes()[0].String() {
+		t.Errorf("unexcepted vote: %#v", c.vote)
+	}
+	if !c.chain.Has(p2.ID) {
+		t.Errorf("uncommitted patch must be restored into chain")
+	}
+
+	if err := j.Checkpoint(c.state, c.term, c.vote, c.chain.After(c.state.PatchID)); err != nil {
+		t.Fatalf("failed to write checkpoint: %s", err.Error())
+	}
+	j.AppendCommit(p2.ID)
+	j.Close()
+
+	j, _ = OpenJournal(dir)
+	c = NewCookFS(nil, nodes, DefaultConfig)
+	c.Journal = j
+	if err := c.Restore(); err != nil {
+		t.Fatalf("failed to restore: %s", err.Error())
+	}
+
+	chain.ApplyTo(state, p2.ID)
+	if c.state.ID != state.ID {
+		t.Errorf("unexcepted state: excepted %s but got %s", state, c.state)
+	}
+	if c.term != 3 {
+		t.Errorf("unexcepted term: excepted 3 but got %d", c.term)
+	}
+}
+
+func Test_Journal_Broken(t *testing.T) {
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+
+	var chain PatchChain
+	p1, _ := chain.New(1, RecipeListPatch{"/foo": &Recipe{}}, nil)
+	p2, _ := chain.New(1, RecipeListPatch{"/bar": &Recipe{}}, nil)
+
+	for _, write := range []func(*Journal){
+		func(j *Journal) { j.AppendPatch(p2) },
+		func(j *Journal) { j.AppendPatch(p1); j.AppendCommit(p2.ID) },
+	} {
+		dir := t.TempDir()
+		j, _ := OpenJournal(dir)
+		write(j)
+		j.Close()
+
+		j, _ = OpenJournal(dir)
+		c := NewCookFS(nil, nodes, DefaultConfig)
+		c.Journal = j
+		if err := c.Restore(); err == nil {
+			t.Errorf("must fail to restore from gapped journal")
+		}
+		j.Close()
+	}
+}
+
+func Test_Journal_CheckpointCrash(t *testing.T) {
+	dir := t.TempDir()
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+
+	var chain PatchChain
+	state := NewState()
+	p1, _ := chain.New(1, RecipeListPatch{"/foo": &Recipe{}}, nil)
+	p2, _ := chain.New(1, RecipeListPatch{"/bar": &Recipe{}}, nil)
+	p3, _ := chain.New(1, RecipeListPatch{"/baz": &Recipe{}}, nil)
+	chain.ApplyTo(state, p2.ID)
+
+	j, _ := OpenJournal(dir)
+	for _, err := range []error{j.AppendTerm(2, Vote{2, nodes()[0]}), j.AppendPatch(p1), j.AppendCommit(p1.ID), j.AppendPatch(p2), j.AppendCommit(p2.ID), j.AppendPatch(p3)} {
+		if err != nil {
+			t.Fatalf("failed to write journal: %s", err.Error())
+		}
+	}
+	j.Close()
+
+	encoded, _ := msgpack.Marshal(state)
+	if err := writeFileSync(filepath.Join(dir, "state"), encoded); err != nil {
+		t.Fatalf("failed to write state: %s", err.Error())
+	}
+
+	j, _ = OpenJournal(dir)
+	defer j.Close()
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.Journal = j
+	if err := c.Restore(); err != nil {
+		t.Fatalf("failed to restore from interrupted checkpoint: %s", err.Error())
+	}
+
+	if c.state.ID != state.ID {
+		t.Errorf("unexcepted state: excepted %s but got %s", state, c.state)
+	}
+	if c.term != 2 {
+		t.Errorf("unexcepted term: excepted 2 but got %d", c.term)
+	}
+	if !c.chain.Has(p3.ID) {
+		t.Errorf("uncommitted patch must be restored into chain")
+	}
+}
+
+func Test_Journal_BrokenRecord(t *testing.T) {
+	dir := t.TempDir()
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+
+	var chain PatchChain
+	p1, _ := chain.New(1, RecipeListPatch{"/foo": &Recipe{}}, nil)
+
+	j, _ := OpenJournal(dir)
+	j.AppendTerm(1, Vote{})
+	j.Close()
+
+	f, _ := os.OpenFile(filepath.Join(dir, "journal"), os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 0, 1, 0xc1})
+	f.Close()
+
+	j, _ = OpenJournal(dir)
+	j.AppendPatch(p1)
+	j.Close()
+
+	info, _ := os.Stat(filepath.Join(dir, "journal"))
+
+	j, _ = OpenJournal(dir)
+	defer j.Close()
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.Journal = j
+	if err := c.Restore(); err == nil {
+		t.Errorf("must fail to restore from journal with broken record")
+	}
+
+	if after, _ := os.Stat(filepath.Join(dir, "journal")); after.Size() != info.Size() {
+		t.Errorf("broken record must not be truncated: %d -> %d", info.Size(), after.Size())
+	}
+}
+
+func Test_Journal_Vote(t *testing.T) {
+	dir := t.TempDir()
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+	a := MustParseNode("http://a.com")
+	b := MustParseNode("http://b.com")
+
+	j, _ := OpenJournal(dir)
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.Journal = j
+
+	if !c.grantVote(PollRequest{Node: a, Term: 2}) {
+		t.Errorf("must grant first vote in term 2")
+	}
+	if c.grantVote(PollRequest{Node: b, Term: 2}) {
+		t.Errorf("must not grant second vote in term 2")
+	}
+	j.Close()
+
+	j, _ = OpenJournal(dir)
+	c = NewCookFS(nil, nodes, DefaultConfig)
+	c.Journal = j
+	if err := c.Restore(); err != nil {
+		t.Fatalf("failed to restore: %s", err.Error())
+	}
+
+	if c.grantVote(PollRequest{Node: b, Term: 2}) {
+		t.Errorf("must not grant second vote in term 2 after restart")
+	}
+	if !c.grantVote(PollRequest{Node: a, Term: 2}) {
+		t.Errorf("must grant vote again to same node")
+	}
+	if !c.grantVote(PollRequest{Node: b, Term: 3}) {
+		t.Errorf("must grant vote in new term")
+	}
+	if term := c.nextTerm(); term != 4 {
+		t.Errorf("candidacy must start after voted term: %d", term)
+	}
+}
+
+func Test_JournalPatch(t *testing.T) {
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.term = 2
+
+	var old PatchChain
+	stale, _ := old.New(1, RecipeListPatch{"/stale": &Recipe{}}, nil)
+	if resp := c.JournalPatch(stale); resp.StatusCode != 409 {
+		t.Errorf("must reject patch from deposed leader but got %d", resp.StatusCode)
+	} else if alive, ok := resp.Data.(AliveMessage); !ok || alive.Term != 2 {
+		t.Errorf("rejection must tell current term: %v", resp.Data)
+	}
+
+	var leader PatchChain
+	p1, _ := leader.New(2, RecipeListPatch{"/foo": &Recipe{}}, nil)
+	p2, _ := leader.New(2, RecipeListPatch{"/bar": &Recipe{}}, nil)
+	for _, p := range []Patch{p1, p2} {
+		if resp := c.JournalPatch(p); resp.StatusCode != 200 {
+			t.Fatalf("failed to add patch: %d", resp.StatusCode)
+		}
+	}
+
+	c.applyTo(p1.ID)
+
+	var other PatchChain
+	other.Reset(c.state)
+	p3, _ := other.New(3, RecipeListPatch{"/baz": &Recipe{}}, nil)
+	if resp := c.JournalPatch(p3); resp.StatusCode != 200 {
+		t.Fatalf("failed to add patch of newer term: %d", resp.StatusCode)
+	}
+	if c.chain.Has(p2.ID) {
+		t.Errorf("conflicting patch must be truncated")
+	}
+
+	var forked PatchChain
+	p4, _ := forked.New(3, RecipeListPatch{"/qux": &Recipe{}}, nil)
+	if resp := c.JournalPatch(p4); resp.StatusCode != 409 {
+		t.Errorf("must reject patch conflicting with committed history but got %d", resp.StatusCode)
+	}
+}
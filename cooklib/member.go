@@ -0,0 +1,214 @@
+package cooklib
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	ErrRemoveLeader      = fmt.Errorf("can not remove leader")
+	ErrMembershipChanged = fmt.Errorf("membership changed concurrently")
+)
+
+func (c *CookFS) Self() *Node {
+	return c.self
+}
+
+func (c *CookFS) members() []*Node {
+	if len(c.state.Members) > 0 {
+		return append([]*Node{}, c.state.Members...)
+	}
+	return c.Bootstrap()
+}
+
+func (c *CookFS) Nodes() []*Node {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.members()
+}
+
+func (c *CookFS) learners() []*Node {
+	return append([]*Node(nil), c.state.Learners...)
+}
+
+func (c *CookFS) Learners() []*Node {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.learners()
+}
+
+func (c *CookFS) membership() Membership {
+	return Membership{c.members(), c.learners()}
+}
+
+func (c *CookFS) Membership() Membership {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.membership()
+}
+
+func (c *CookFS) allNodes() []*Node {
+	m := c.Membership()
+	return append(m.Members, m.Learners...)
+}
+
+func hasNode(nodes []*Node, node *Node) bool {
+	for _, n := range nodes {
+		if n.String() == node.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CookFS) IsMember(node *Node) bool {
+	return hasNode(c.Nodes(), node)
+}
+
+func changeMembers(members []*Node, node *Node, remove bool) ([]*Node, bool) {
+	result := []*Node{}
+	found := false
+
+	for _, n := range members {
+		if n.String() == node.String() {
+			found = true
+			if remove {
+				continue
+			}
+		}
+		result = append(result, n)
+	}
+
+	if found == remove {
+		if !remove {
+			result = append(result, node)
+		}
+		return result, true
+	}
+
+	return members, false
+}
+
+func sameMembers(a, b []*Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CookFS) updateMembership(update func(Membership) (Membership, bool)) (Membership, error) {
+	current := c.Membership()
+	next, changed := update(current)
+	if !changed {
+		return current, nil
+	}
+	if len(next.Learners) == 0 {
+		next.Learners = nil
+	}
+
+	_, err := c.commit(Patch{Members: next.Members, Learners: next.Learners}, func(state *State) error {
+		m := c.membership()
+		if !sameMembers(m.Members, current.Members) || !sameMembers(m.Learners, current.Learners) {
+			return ErrMembershipChanged
+		}
+		return nil
+	})
+	if err != nil {
+		return Membership{}, err
+	}
+
+	return next, nil
+}
+
+func (c *CookFS) ChangeMember(node *Node, remove bool) (Membership, error) {
+	if c.Role() != Leader {
+		return Membership{}, ErrNotLeader
+	}
+	if remove && node.String() == c.self.String() {
+		return Membership{}, ErrRemoveLeader
+	}
+
+	membership, err := c.updateMembership(func(m Membership) (Membership, bool) {
+		if remove {
+			members, removedMember := changeMembers(m.Members, node, true)
+			learners, removedLearner := changeMembers(m.Learners, node, true)
+			return Membership{members, learners}, removedMember || removedLearner
+		}
+
+		if hasNode(m.Members, node) {
+			return m, false
+		}
+		learners, added := changeMembers(m.Learners, node, false)
+		return Membership{m.Members, learners}, added
+	})
+	if err != nil {
+		return Membership{}, err
+	}
+
+	if remove {
+		c.lock.Lock()
+		msg := AliveMessage{c.self, c.term, c.state.PatchID, c.state.Index, c.priority()}
+		c.lock.Unlock()
+
+		c.workers().SendOnly(context.Background(), []*Node{node}, "/term", msg, c.Config.AliveTimeout)
+	}
+
+	return membership, nil
+}
+
+func (c *CookFS) Promote(node *Node) error {
+	_, err := c.updateMembership(func(m Membership) (Membership, bool) {
+		learners, removed := changeMembers(m.Learners, node, true)
+		if !removed {
+			return m, false
+		}
+		members, _ := changeMembers(m.Members, node, false)
+		return Membership{members, learners}, true
+	})
+	if err == nil {
+		fmt.Println("promoted learner", node)
+	}
+	return err
+}
+
+func (c *CookFS) syncLearners(ctx context.Context, worker WorkerPool, msg AliveMessage) {
+	if !atomic.CompareAndSwapInt32(&c.syncingLearners, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.syncingLearners, 0)
+
+	for _, learner := range c.Learners() {
+		for _, resp := range worker.SendAll(ctx, []*Node{learner}, "/term", msg, c.Config.AliveTimeout) {
+			if alive, ok := resp.Data.(*AliveMessage); ok && resp.StatusCode == 200 && alive.Index >= msg.Index {
+				c.Promote(learner)
+			}
+		}
+	}
+}
+
+func (c *CookFS) MemberRequest(request MemberRequest) Response {
+	membership, err := c.ChangeMember(request.Node, request.Remove)
+	switch err {
+	case nil:
+		return Response{200, membership}
+	case ErrNotLeader:
+		forwarded := request.Forwarded
+		request.Forwarded = true
+		return c.forwardToLeader("/member", request, forwarded)
+	case ErrRemoveLeader, ErrMembershipChanged:
+		return Response{StatusCode: 409}
+	case ErrReplicationFailed:
+		return Response{StatusCode: 503}
+	default:
+		return Response{StatusCode: 500}
+	}
+}
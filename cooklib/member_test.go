@@ -0,0 +1,66 @@
+package cooklib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_changeMembers(t *testing.T) {
+	a := MustParseNode("http://a.com")
+	b := MustParseNode("http://b.com")
+	c := MustParseNode("http://c.com")
+
+	members, changed := changeMembers([]*Node{a, b}, c, false)
+	if !changed || fmt.Sprint(members) != "[http://a.com http://b.com http://c.com]" {
+		t.Errorf("unexcepted result of add: %v (changed=%v)", members, changed)
+	}
+
+	members, changed = changeMembers(members, MustParseNode("http://b.com"), true)
+	if !changed || fmt.Sprint(members) != "[http://a.com http://c.com]" {
+		t.Errorf("unexcepted result of remove: %v (changed=%v)", members, changed)
+	}
+
+	if _, changed = changeMembers(members, a, false); changed {
+		t.Errorf("adding existing member must not change members")
+	}
+	if _, changed = changeMembers(members, b, true); changed {
+		t.Errorf("removing unknown member must not change members")
+	}
+}
+
+func Test_Members(t *testing.T) {
+	nodes := func() []*Node { return []*Node{MustParseNode("http://a.com"), MustParseNode("http://b.com")} }
+	c := NewCookFS(nil, nodes, DefaultConfig)
+
+	if fmt.Sprint(c.Nodes()) != "[http://a.com http://b.com]" {
+		t.Errorf("must use bootstrap nodes before membership committed: %v", c.Nodes())
+	}
+
+	var chain PatchChain
+	patch, _ := chain.Extend(1, Patch{Members: []*Node{MustParseNode("http://b.com"), MustParseNode("http://c.com")}})
+	c.state.Apply(patch)
+
+	if fmt.Sprint(c.Nodes()) != "[http://b.com http://c.com]" {
+		t.Errorf("must use committed members: %v", c.Nodes())
+	}
+	if c.IsMember(c.Self()) {
+		t.Errorf("removed node must not be member")
+	}
+
+	patch, _ = chain.Extend(1, Patch{Members: []*Node{MustParseNode("http://b.com")}, Learners: []*Node{MustParseNode("http://a.com")}})
+	c.state.Apply(patch)
+
+	if c.IsMember(c.Self()) {
+		t.Errorf("learner must not be voting member")
+	}
+	if fmt.Sprint(c.allNodes()) != "[http://b.com http://a.com]" {
+		t.Errorf("learners must receive replication: %v", c.allNodes())
+	}
+
+	patch, _ = chain.Extend(1, Patch{Members: []*Node{MustParseNode("http://a.com"), MustParseNode("http://b.com")}})
+	c.state.Apply(patch)
+
+	if !c.IsMember(c.Self()) || len(c.Learners()) != 0 {
+		t.Errorf("promoted learner must be voting member: %v", c.Membership())
+	}
+}
@@ -43,6 +43,10 @@ func (n *Node) MarshalJSON() ([]byte, error) {
 	return []byte(s), nil
 }
 
+func (n *Node) MarshalYAML() (interface{}, error) {
+	return n.String(), nil
+}
+
 func (n *Node) UnmarshalMsgpack(raw []byte) error {
 	var s string
 
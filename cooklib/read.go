@@ -0,0 +1,206 @@
+package cooklib
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoLeader              = fmt.Errorf("no leader")
+	ErrLeadershipUnconfirmed = fmt.Errorf("failed to confirm leadership")
+	ErrTooStale              = fmt.Errorf("too far behind leader")
+	ErrUnknownConsistency    = fmt.Errorf("unknown consistency level")
+)
+
+type Consistency int
+
+const (
+	Linearizable Consistency = iota
+	BoundedStaleness
+	AnyConsistency
+)
+
+func (c Consistency) String() string {
+	switch c {
+	case Linearizable:
+		return "linearizable"
+	case BoundedStaleness:
+		return "bounded"
+	case AnyConsistency:
+		return "any"
+	default:
+		return fmt.Sprintf("Consistency(%d)", int(c))
+	}
+}
+
+func ParseConsistency(s string) (Consistency, error) {
+	for _, c := range []Consistency{Linearizable, BoundedStaleness, AnyConsistency} {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return 0, ErrUnknownConsistency
+}
+
+func (c *CookFS) extendLease(sentAt time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if lease := sentAt.Add(c.Config.AliveTimeout); lease.After(c.lease) {
+		c.lease = lease
+	}
+}
+
+func (c *CookFS) readIndex(ctx context.Context) (ReadIndex, error) {
+	c.lock.Lock()
+	if c.role != Leader {
+		c.lock.Unlock()
+		return ReadIndex{}, ErrNotLeader
+	}
+	index := ReadIndex{c.state.PatchID, c.state.Index}
+	ready := c.state.Term == c.term
+	leased := time.Now().Before(c.lease)
+	msg := AliveMessage{c.self, c.term, c.state.PatchID, c.state.Index, c.priority()}
+	c.lock.Unlock()
+
+	if !ready {
+		return ReadIndex{}, ErrLeadershipUnconfirmed
+	}
+	if leased {
+		return index, nil
+	}
+
+	sentAt := time.Now()
+	if !c.workers().OverHalf(ctx, c.Nodes(), "/term", msg, c.Config.AliveTimeout) {
+		return ReadIndex{}, ErrLeadershipUnconfirmed
+	}
+	c.extendLease(sentAt)
+
+	return index, nil
+}
+
+func (c *CookFS) ReadIndexRequest() Response {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout)
+	defer cancel()
+
+	index, err := c.readIndex(ctx)
+	switch err {
+	case nil:
+		return Response{200, index}
+	case ErrNotLeader:
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		return Response{307, AliveMessage{c.leader, c.term, c.state.PatchID, c.state.Index, c.priority()}}
+	default:
+		return Response{StatusCode: 503}
+	}
+}
+
+func (c *CookFS) fetchReadIndex(ctx context.Context, leader *Node) (ReadIndex, error) {
+	if leader.String() == "" {
+		return ReadIndex{}, ErrNoLeader
+	}
+
+	resp := c.Handler.Send(ctx, Request{leader, "/journal/index", nil, c.Config.CommitTimeout})
+	switch resp.StatusCode {
+	case 200:
+		index, ok := resp.Data.(*ReadIndex)
+		if !ok {
+			return ReadIndex{}, ErrLeadershipUnconfirmed
+		}
+		return *index, nil
+	case 307, 502:
+		return ReadIndex{}, ErrNoLeader
+	default:
+		return ReadIndex{}, ErrLeadershipUnconfirmed
+	}
+}
+
+func (c *CookFS) waitApplied(ctx context.Context, leader *Node, index ReadIndex) error {
+	for {
+		c.lock.Lock()
+		if c.state.Index < index.Index && c.chain.Has(index.PatchID) {
+			c.applyTo(index.PatchID)
+		}
+		applied := c.state.Index >= index.Index
+		c.lock.Unlock()
+
+		if applied {
+			return nil
+		}
+
+		c.CatchUp(leader)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.Config.AliveInterval / 4):
+		}
+	}
+}
+
+func (c *CookFS) linearize() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout)
+	defer cancel()
+
+	index, err := c.readIndex(ctx)
+	if err != ErrNotLeader {
+		return err
+	}
+
+	leader := c.Leader()
+	if index, err = c.fetchReadIndex(ctx, leader); err != nil {
+		return err
+	}
+
+	return c.waitApplied(ctx, leader, index)
+}
+
+func (c *CookFS) lag() (int64, bool) {
+	if c.role == Leader {
+		return 0, true
+	}
+
+	lag := c.leaderIndex - c.state.Index
+	if lag < 0 {
+		lag = 0
+	}
+
+	return lag, time.Since(c.lastAlive) < c.Config.LeaderDeathTimer
+}
+
+func (c *CookFS) prepareRead(level Consistency) (int64, error) {
+	switch level {
+	case Linearizable:
+		return 0, c.linearize()
+
+	case BoundedStaleness:
+		c.lock.Lock()
+		lag, alive := c.lag()
+		c.lock.Unlock()
+
+		if !alive || lag > int64(c.Config.MaxReadLag) {
+			return lag, ErrTooStale
+		}
+		return lag, nil
+
+	case AnyConsistency:
+		c.lock.Lock()
+		lag, _ := c.lag()
+		c.lock.Unlock()
+
+		return lag, nil
+
+	default:
+		return 0, ErrUnknownConsistency
+	}
+}
+
+func readError(err error) Response {
+	if err == ErrUnknownConsistency {
+		return Response{StatusCode: 400}
+	}
+	return Response{StatusCode: 503}
+}
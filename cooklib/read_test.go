@@ -0,0 +1,76 @@
+package cooklib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_readIndex(t *testing.T) {
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	ctx := context.Background()
+
+	if _, err := c.readIndex(ctx); err != ErrNotLeader {
+		t.Errorf("follower must not serve read index: %v", err)
+	}
+
+	c.role = Leader
+	c.term = 2
+	c.leader = c.self
+	c.lease = time.Now().Add(time.Minute)
+
+	if _, err := c.readIndex(ctx); err != ErrLeadershipUnconfirmed {
+		t.Errorf("leader must not serve read index before committing in its term: %v", err)
+	}
+
+	patch, _ := c.chain.New(2, RecipeListPatch{"/foo": &Recipe{}}, nil)
+	c.applyTo(patch.ID)
+
+	index, err := c.readIndex(ctx)
+	if err != nil {
+		t.Fatalf("failed to get read index: %s", err.Error())
+	}
+	if index.PatchID != patch.ID || index.Index != 1 {
+		t.Errorf("unexcepted read index: %#v", index)
+	}
+}
+
+func Test_prepareRead(t *testing.T) {
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+	config := DefaultConfig
+	config.MaxReadLag = 2
+	c := NewCookFS(nil, nodes, config)
+
+	if _, err := c.prepareRead(BoundedStaleness); err != ErrTooStale {
+		t.Errorf("must refuse bounded read without leader: %v", err)
+	}
+	if _, err := c.prepareRead(AnyConsistency); err != nil {
+		t.Errorf("must accept any read without leader: %v", err)
+	}
+	if _, err := c.prepareRead(Consistency(42)); err != ErrUnknownConsistency {
+		t.Errorf("must reject unknown consistency: %v", err)
+	}
+
+	c.lastAlive = time.Now()
+	c.leaderIndex = 2
+	if lag, err := c.prepareRead(BoundedStaleness); err != nil || lag != 2 {
+		t.Errorf("must accept bounded read within lag: lag=%d err=%v", lag, err)
+	}
+
+	c.leaderIndex = 3
+	if lag, err := c.prepareRead(BoundedStaleness); err != ErrTooStale || lag != 3 {
+		t.Errorf("must refuse bounded read beyond lag: lag=%d err=%v", lag, err)
+	}
+}
+
+func Test_ParseConsistency(t *testing.T) {
+	for _, c := range []Consistency{Linearizable, BoundedStaleness, AnyConsistency} {
+		if parsed, err := ParseConsistency(c.String()); err != nil || parsed != c {
+			t.Errorf("failed to parse %s: %v %v", c, parsed, err)
+		}
+	}
+	if _, err := ParseConsistency("strong"); err != ErrUnknownConsistency {
+		t.Errorf("must reject unknown level: %v", err)
+	}
+}
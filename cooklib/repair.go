@@ -0,0 +1,155 @@
+package cooklib
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+func (c *CookFS) ReplicateRequest(request ReplicateRequest) Response {
+	if c.Chunks.Has(request.Chunk) {
+		return Response{200, c.self}
+	}
+
+	for _, source := range request.Sources {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout)
+		data, err := c.Handler.FetchChunk(ctx, source, request.Chunk)
+		cancel()
+
+		if err != nil || NewChunkID(data) != request.Chunk {
+			continue
+		}
+
+		if err := c.storeChunk(request.Chunk, data); err != nil {
+			return Response{StatusCode: 500}
+		}
+
+		return Response{200, c.self}
+	}
+
+	return Response{StatusCode: 502}
+}
+
+func (c *CookFS) AliveNodes(ctx context.Context) []*Node {
+	nodes := c.allNodes()
+	responses := make(chan *Node, len(nodes))
+
+	for _, node := range nodes {
+		go func(node *Node) {
+			ctx, cancel := context.WithTimeout(ctx, c.Config.AliveTimeout)
+			defer cancel()
+
+			if c.Handler.Send(ctx, Request{node, "/term", nil, c.Config.AliveTimeout}).StatusCode == 200 {
+				responses <- node
+			} else {
+				responses <- nil
+			}
+		}(node)
+	}
+
+	alive := []*Node{}
+	for range nodes {
+		if node := <-responses; node != nil {
+			alive = append(alive, node)
+		}
+	}
+
+	return alive
+}
+
+type repairJob struct {
+	chunk   ChunkID
+	holders []*Node
+}
+
+func (c *CookFS) findUnderReplicated(alive []*Node) []repairJob {
+	isAlive := make(map[string]bool)
+	for _, node := range alive {
+		isAlive[node.String()] = true
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	jobs := []repairJob{}
+	for chunk, holders := range c.state.ChunkHolders {
+		live := []*Node{}
+		for _, node := range holders {
+			if isAlive[node.String()] {
+				live = append(live, node)
+			}
+		}
+
+		if len(live) == 0 {
+			fmt.Println("no alive holder of chunk", chunk)
+		} else if len(live) < c.Config.ReplicationFactor {
+			jobs = append(jobs, repairJob{chunk, live})
+		}
+	}
+
+	return jobs
+}
+
+func (c *CookFS) Repair(ctx context.Context) error {
+	alive := c.AliveNodes(ctx)
+
+	patch := make(ChunkHoldersPatch)
+
+	for _, job := range c.findUnderReplicated(alive) {
+		holding := make(map[string]bool)
+		for _, node := range job.holders {
+			holding[node.String()] = true
+		}
+
+		need := c.Config.ReplicationFactor - len(job.holders)
+
+		for _, i := range rand.Perm(len(alive)) {
+			if need <= 0 {
+				break
+			}
+			if holding[alive[i].String()] {
+				continue
+			}
+
+			sendCtx, cancel := context.WithTimeout(ctx, c.Config.CommitTimeout)
+			resp := c.Handler.Send(sendCtx, Request{alive[i], "/replicate", ReplicateRequest{job.chunk, job.holders}, c.Config.CommitTimeout})
+			cancel()
+
+			if holder, ok := resp.Data.(*Node); ok && resp.StatusCode == 200 {
+				patch.AddChunk(holder, job.chunk)
+				need--
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+
+	if len(patch) == 0 {
+		return nil
+	}
+
+	_, err := c.Commit(nil, patch)
+	return err
+}
+
+func (c *CookFS) RunRepair(ctx context.Context) {
+	ticker := time.NewTicker(c.Config.RepairInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Repair(ctx); err != nil {
+				fmt.Println("failed to repair:", err.Error())
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package cooklib
+
+import (
+	"fmt"
+)
+
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+func (c *CookFS) Role() Role {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.role
+}
+
+func (c *CookFS) Term() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.term
+}
+
+func (c *CookFS) Leader() *Node {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.leader
+}
+
+func (c *CookFS) setTerm(term int64) {
+	if term != c.term {
+		c.term = term
+		c.persistTerm()
+	}
+}
+
+func (c *CookFS) nextTerm() int64 {
+	if c.vote.Term > c.term {
+		return c.vote.Term + 1
+	}
+	return c.term + 1
+}
+
+func (c *CookFS) becomeFollower(term int64, leader *Node) {
+	if c.role != Follower {
+		fmt.Println("been follower of term", term)
+	}
+
+	if c.stopLeader != nil {
+		c.stopLeader()
+		c.stopLeader = nil
+	}
+
+	c.setTerm(term)
+	c.leader = leader
+	c.role = Follower
+}
+
+func (c *CookFS) becomeCandidate() bool {
+	if c.role == Leader {
+		return false
+	}
+
+	c.role = Candidate
+	return true
+}
+
+func (c *CookFS) becomeLeader(term int64) bool {
+	if c.role != Candidate || c.term > term {
+		return false
+	}
+
+	c.setTerm(term)
+	c.leader = c.self
+	c.role = Leader
+
+	fmt.Println("been leader of term", term)
+
+	return true
+}
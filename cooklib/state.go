@@ -21,6 +21,11 @@ func NewUUID(data []byte) UUID {
 	return UUID(uuid.NewSHA1(Namespace, data))
 }
 
+func ParseUUID(raw string) (UUID, error) {
+	u, err := uuid.Parse(raw)
+	return UUID(u), err
+}
+
 func (u UUID) String() string {
 	return uuid.UUID(u).String()
 }
@@ -50,6 +55,10 @@ func (u *UUID) UnmarshalJSON(raw []byte) error {
 	return nil
 }
 
+func (u UUID) MarshalYAML() (interface{}, error) {
+	return u.String(), nil
+}
+
 type ChunkID struct {
 	UUID
 }
@@ -58,6 +67,11 @@ func NewChunkID(data []byte) ChunkID {
 	return ChunkID{NewUUID(data)}
 }
 
+func ParseChunkID(raw string) (ChunkID, error) {
+	u, err := ParseUUID(raw)
+	return ChunkID{u}, err
+}
+
 type Recipe struct {
 	Size   int64
 	Chunks []ChunkID
@@ -101,16 +115,20 @@ func (r RecipeList) MarshalMsgpack() ([]byte, error) {
 
 type ChunkHolders map[ChunkID][]*Node
 
+func (c ChunkHolders) search(chunk ChunkID, node *Node) int {
+	return sort.Search(len(c[chunk]), func(i int) bool {
+		return strings.Compare(c[chunk][i].String(), node.String()) >= 0
+	})
+}
+
 func (c ChunkHolders) Delete(chunk ChunkID, node *Node) {
 	if _, ok := c[chunk]; !ok {
 		return
 	}
 
-	idx := sort.Search(len(c[chunk]), func(i int) bool {
-		return strings.Compare(c[chunk][i].String(), node.String()) >= 0
-	})
+	idx := c.search(chunk, node)
 
-	if idx >= 0 && idx < len(c[chunk]) {
+	if idx < len(c[chunk]) && c[chunk][idx].String() == node.String() {
 		c[chunk] = append(c[chunk][:idx], c[chunk][idx+1:]...)
 
 		if len(c[chunk]) == 0 {
@@ -125,17 +143,15 @@ func (c ChunkHolders) Add(chunk ChunkID, node *Node) {
 		return
 	}
 
-	idx := sort.Search(len(c[chunk]), func(i int) bool {
-		return strings.Compare(c[chunk][i].String(), node.String()) >= 0
-	})
+	idx := c.search(chunk, node)
 
-	if idx < 0 {
-		c[chunk] = append(c[chunk], node)
-
-		sort.Slice(c[chunk], func(i, j int) bool {
-			return strings.Compare(c[chunk][i].String(), c[chunk][j].String()) >= 0
-		})
+	if idx < len(c[chunk]) && c[chunk][idx].String() == node.String() {
+		return
 	}
+
+	c[chunk] = append(c[chunk], nil)
+	copy(c[chunk][idx+1:], c[chunk][idx:])
+	c[chunk][idx] = node
 }
 
 func (c ChunkHolders) Apply(patch ChunkHoldersPatch) {
@@ -185,11 +201,35 @@ func (c ChunkPatch) MarshalMsgpack() ([]byte, error) {
 		return bytes.Compare(c.Del[i].Binary(), c.Del[j].Binary()) >= 0
 	})
 
-	return msgpack.Marshal(c)
+	type plain ChunkPatch
+	return msgpack.Marshal(plain(c))
 }
 
 type ChunkHoldersPatch map[*Node]ChunkPatch
 
+func (c ChunkHoldersPatch) key(node *Node) *Node {
+	for k := range c {
+		if k.String() == node.String() {
+			return k
+		}
+	}
+	return node
+}
+
+func (c ChunkHoldersPatch) AddChunk(node *Node, chunk ChunkID) {
+	k := c.key(node)
+	p := c[k]
+	p.Add = append(p.Add, chunk)
+	c[k] = p
+}
+
+func (c ChunkHoldersPatch) DelChunk(node *Node, chunk ChunkID) {
+	k := c.key(node)
+	p := c[k]
+	p.Del = append(p.Del, chunk)
+	c[k] = p
+}
+
 func (c ChunkHoldersPatch) EncodeMsgpack(enc *msgpack.Encoder) error {
 	if err := enc.EncodeMapLen(len(c)); err != nil {
 		return err
@@ -219,10 +259,18 @@ type StateID struct {
 func calcStateID(state *State) StateID {
 	encoded, _ := msgpack.Marshal(struct {
 		PatchID      PatchID
+		Index        int64
+		Term         int64
+		Members      []*Node
+		Learners     []*Node
 		Recipes      RecipeList
 		ChunkHolders ChunkHolders
 	}{
 		state.PatchID,
+		state.Index,
+		state.Term,
+		state.Members,
+		state.Learners,
 		state.Recipes,
 		state.ChunkHolders,
 	})
@@ -233,6 +281,10 @@ func calcStateID(state *State) StateID {
 type State struct {
 	ID           StateID      `json:"id"`
 	PatchID      PatchID      `json:"patch_id"`
+	Index        int64        `json:"index"`
+	Term         int64        `json:"term"`
+	Members      []*Node      `json:"members"`
+	Learners     []*Node      `json:"learners"`
 	Recipes      RecipeList   `json:"recipes"`
 	ChunkHolders ChunkHolders `json:"chunk_holders"`
 }
@@ -245,12 +297,36 @@ func NewState() *State {
 	return &s
 }
 
+func (s *State) Copy() *State {
+	c := &State{
+		ID:           s.ID,
+		PatchID:      s.PatchID,
+		Index:        s.Index,
+		Term:         s.Term,
+		Members:      append([]*Node(nil), s.Members...),
+		Learners:     append([]*Node(nil), s.Learners...),
+		Recipes:      make(RecipeList, len(s.Recipes)),
+		ChunkHolders: make(ChunkHolders, len(s.ChunkHolders)),
+	}
+
+	for k, v := range s.Recipes {
+		c.Recipes[k] = v
+	}
+
+	for k, v := range s.ChunkHolders {
+		c.ChunkHolders[k] = append([]*Node{}, v...)
+	}
+
+	return c
+}
+
 func (s *State) String() string {
 	return fmt.Sprintf("State[ID=%s Recipes=%d]", s.ID, len(s.Recipes))
 }
 
 func (s *State) UnmarshalMsgpack(raw []byte) error {
-	if err := msgpack.Unmarshal(raw, s); err != nil {
+	type plain State
+	if err := msgpack.Unmarshal(raw, (*plain)(s)); err != nil {
 		return err
 	}
 
@@ -263,7 +339,8 @@ func (s *State) UnmarshalMsgpack(raw []byte) error {
 }
 
 func (s *State) UnmarshalJSON(raw []byte) error {
-	if err := json.Unmarshal(raw, s); err != nil {
+	type plain State
+	if err := json.Unmarshal(raw, (*plain)(s)); err != nil {
 		return err
 	}
 
@@ -279,7 +356,14 @@ func (s *State) Apply(patch Patch) {
 	s.Recipes.Apply(patch.Recipes)
 	s.ChunkHolders.Apply(patch.Chunks)
 
+	if patch.Members != nil {
+		s.Members = append([]*Node{}, patch.Members...)
+		s.Learners = append([]*Node(nil), patch.Learners...)
+	}
+
 	s.PatchID = patch.ID
+	s.Index = patch.Index
+	s.Term = patch.Term
 	s.ID = calcStateID(s)
 }
 
@@ -290,10 +374,18 @@ type PatchID struct {
 func calcPatchID(patch Patch) PatchID {
 	encoded, _ := msgpack.Marshal(struct {
 		Previous PatchID
+		Term     int64
+		Index    int64
+		Members  []*Node
+		Learners []*Node
 		Recipes  RecipeListPatch
 		Chunks   ChunkHoldersPatch
 	}{
 		patch.Previous,
+		patch.Term,
+		patch.Index,
+		patch.Members,
+		patch.Learners,
 		patch.Recipes,
 		patch.Chunks,
 	})
@@ -304,13 +396,19 @@ func calcPatchID(patch Patch) PatchID {
 type Patch struct {
 	Previous PatchID           `json:"previous"`
 	ID       PatchID           `json:"id"`
+	Term     int64             `json:"term"`
+	Index    int64             `json:"index"`
+	Members  []*Node           `json:"members,omitempty"`
+	Learners []*Node           `json:"learners,omitempty"`
 	Recipes  RecipeListPatch   `json:"recipes"`
 	Chunks   ChunkHoldersPatch `json:"chunks"`
 }
 
-func NewPatch(previous PatchID, recipes RecipeListPatch, chunks ChunkHoldersPatch) (Patch, error) {
+func NewPatch(previous PatchID, term, index int64, recipes RecipeListPatch, chunks ChunkHoldersPatch) (Patch, error) {
 	p := Patch{
 		Previous: previous,
+		Term:     term,
+		Index:    index,
 		Recipes:  recipes,
 		Chunks:   chunks,
 	}
@@ -332,36 +430,16 @@ func (p Patch) RecipesNum() (added, deleted int) {
 }
 
 func (p Patch) ChunksNum() (added, deleted int) {
-	a := []ChunkID{}
-	d := []ChunkID{}
+	a := make(map[ChunkID]struct{})
+	d := make(map[ChunkID]struct{})
 
 	for _, c := range p.Chunks {
 		for _, chunk := range c.Add {
-			idx := sort.Search(len(a), func(i int) bool {
-				return bytes.Compare(a[i].Binary(), chunk.Binary()) >= 0
-			})
-			if idx >= 0 {
-				continue
-			}
-
-			a = append(a, chunk)
-			sort.Slice(a, func(i, j int) bool {
-				return bytes.Compare(a[i].Binary(), a[j].Binary()) >= 0
-			})
+			a[chunk] = struct{}{}
 		}
 
 		for _, chunk := range c.Del {
-			idx := sort.Search(len(d), func(i int) bool {
-				return bytes.Compare(d[i].Binary(), chunk.Binary()) >= 0
-			})
-			if idx >= 0 {
-				continue
-			}
-
-			d = append(d, chunk)
-			sort.Slice(d, func(i, j int) bool {
-				return bytes.Compare(d[i].Binary(), d[j].Binary()) >= 0
-			})
+			d[chunk] = struct{}{}
 		}
 	}
 
@@ -371,11 +449,12 @@ func (p Patch) ChunksNum() (added, deleted int) {
 func (p Patch) String() string {
 	addedRecipe, deletedRecipe := p.RecipesNum()
 	addedChunk, deletedChunk := p.ChunksNum()
-	return fmt.Sprintf("Patch[ID=%s Previous=%s AddedRecipes=%d DeletedRecipes=%d AddedChunk=%d DeletedChunk=%d]", p.ID, p.Previous, addedRecipe, deletedRecipe, addedChunk, deletedChunk)
+	return fmt.Sprintf("Patch[ID=%s Previous=%s Term=%d Index=%d AddedRecipes=%d DeletedRecipes=%d AddedChunk=%d DeletedChunk=%d]", p.ID, p.Previous, p.Term, p.Index, addedRecipe, deletedRecipe, addedChunk, deletedChunk)
 }
 
 func (p *Patch) UnmarshalMsgpack(raw []byte) error {
-	if err := msgpack.Unmarshal(raw, p); err != nil {
+	type plain Patch
+	if err := msgpack.Unmarshal(raw, (*plain)(p)); err != nil {
 		return err
 	}
 
@@ -388,7 +467,8 @@ func (p *Patch) UnmarshalMsgpack(raw []byte) error {
 }
 
 func (p *Patch) UnmarshalJSON(raw []byte) error {
-	if err := json.Unmarshal(raw, p); err != nil {
+	type plain Patch
+	if err := json.Unmarshal(raw, (*plain)(p)); err != nil {
 		return err
 	}
 
@@ -401,13 +481,24 @@ func (p *Patch) UnmarshalJSON(raw []byte) error {
 }
 
 type PatchChain struct {
-	chain []Patch
+	base      PatchID
+	baseIndex int64
+	chain     []Patch
 }
 
 func (c *PatchChain) String() string {
 	return fmt.Sprint(c.chain)
 }
 
+func (c *PatchChain) Get(id PatchID) (Patch, bool) {
+	for _, p := range c.chain {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Patch{}, false
+}
+
 func (c *PatchChain) Has(id PatchID) bool {
 	for _, p := range c.chain {
 		if p.ID == id {
@@ -418,20 +509,87 @@ func (c *PatchChain) Has(id PatchID) bool {
 }
 
 func (c *PatchChain) ApplyTo(state *State, id PatchID) error {
-	if !c.Has(id) {
-		return fmt.Errorf("unknown entry")
+	if state.PatchID == id {
+		return nil
 	}
 
+	start := -1
+	end := -1
 	for i, p := range c.chain {
+		if start < 0 && p.Previous == state.PatchID {
+			start = i
+		}
+		if p.ID == id {
+			end = i
+		}
+	}
+
+	if end < 0 {
+		return fmt.Errorf("unknown entry")
+	}
+	if start < 0 || start > end {
+		return fmt.Errorf("not chained")
+	}
+
+	for _, p := range c.chain[start : end+1] {
 		state.Apply(p)
+	}
+
+	return nil
+}
 
+func (c *PatchChain) Compact(applied PatchID, keep int) {
+	for i, p := range c.chain {
+		if p.ID == applied {
+			if start := i + 1 - keep; start > 0 && keep > 0 {
+				c.base = c.chain[start-1].ID
+				c.baseIndex = c.chain[start-1].Index
+				c.chain = c.chain[start:]
+			}
+			return
+		}
+	}
+}
+
+func (c *PatchChain) Since(id PatchID, until PatchID) ([]Patch, error) {
+	start := -1
+	if id == c.base {
+		start = 0
+	}
+	for i, p := range c.chain {
 		if p.ID == id {
-			c.chain = c.chain[:i]
-			break
+			start = i + 1
+		}
+		if p.ID == until && start >= 0 {
+			return append([]Patch{}, c.chain[start:i+1]...), nil
 		}
 	}
 
-	return nil
+	if start >= 0 && id == until {
+		return []Patch{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown entry")
+}
+
+func (c *PatchChain) After(id PatchID) []Patch {
+	for i, p := range c.chain {
+		if p.ID == id {
+			return append([]Patch{}, c.chain[i+1:]...)
+		}
+	}
+
+	if id == c.base {
+		return append([]Patch{}, c.chain...)
+	}
+
+	return []Patch{}
+}
+
+func (c *PatchChain) Reset(state *State) {
+	c.base = state.PatchID
+	c.baseIndex = state.Index
+	c.chain = nil
 }
 
 func (c *PatchChain) Add(patch Patch) error {
@@ -440,6 +598,10 @@ func (c *PatchChain) Add(patch Patch) error {
 		return nil
 	}
 
+	if c.Has(patch.ID) {
+		return nil
+	}
+
 	for i, p := range c.chain {
 		if p.ID == patch.Previous {
 			c.chain = append(c.chain[:i+1], patch)
@@ -447,19 +609,46 @@ func (c *PatchChain) Add(patch Patch) error {
 		}
 	}
 
+	if c.chain[0].Previous == patch.Previous {
+		c.chain = []Patch{patch}
+		return nil
+	}
+
 	return fmt.Errorf("not chained")
 }
 
-func (c *PatchChain) New(recipes RecipeListPatch, chunks ChunkHoldersPatch) (Patch, error) {
-	prev := PatchID{}
-	if len(c.chain) > 0 {
-		prev = c.chain[len(c.chain)-1].ID
+func (c *PatchChain) Rollback(id PatchID) {
+	for i, p := range c.chain {
+		if p.ID == id {
+			c.chain = c.chain[:i]
+			return
+		}
 	}
+}
 
-	patch, err := NewPatch(prev, recipes, chunks)
-	if err != nil {
-		return Patch{}, err
+func (c *PatchChain) Last(state *State) (term, index int64) {
+	pending := c.After(state.PatchID)
+	if len(pending) == 0 {
+		return state.Term, state.Index
 	}
+
+	last := pending[len(pending)-1]
+	return last.Term, last.Index
+}
+
+func (c *PatchChain) New(term int64, recipes RecipeListPatch, chunks ChunkHoldersPatch) (Patch, error) {
+	return c.Extend(term, Patch{Recipes: recipes, Chunks: chunks})
+}
+
+func (c *PatchChain) Extend(term int64, patch Patch) (Patch, error) {
+	patch.Previous, patch.Index = c.base, c.baseIndex
+	if len(c.chain) > 0 {
+		patch.Previous, patch.Index = c.chain[len(c.chain)-1].ID, c.chain[len(c.chain)-1].Index
+	}
+
+	patch.Term = term
+	patch.Index++
+	patch.ID = calcPatchID(patch)
 	c.chain = append(c.chain, patch)
 
 	return patch, nil
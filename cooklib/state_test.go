@@ -141,3 +141,222 @@ func Test_ChunkHoldersPatch(t *testing.T) {
 		t.Errorf("unexcepted chunk holder: excepted http://example.com but got %s", ch[NewChunkID([]byte("fuga"))][0].String())
 	}
 }
+
+func Test_ChunkHolders_Add(t *testing.T) {
+	chunk := NewChunkID([]byte("hello"))
+	ch := ChunkHolders{}
+
+	ch.Add(chunk, MustParseNode("http://c.com"))
+	ch.Add(chunk, MustParseNode("http://a.com"))
+	ch.Add(chunk, MustParseNode("http://b.com"))
+	ch.Add(chunk, MustParseNode("http://a.com"))
+
+	if fmt.Sprint(ch[chunk]) != "[http://a.com http://b.com http://c.com]" {
+		t.Errorf("unexcepted chunk holders: %s", ch[chunk])
+	}
+
+	ch.Delete(chunk, MustParseNode("http://b.com"))
+	ch.Delete(chunk, MustParseNode("http://d.com"))
+
+	if fmt.Sprint(ch[chunk]) != "[http://a.com http://c.com]" {
+		t.Errorf("unexcepted chunk holders: %s", ch[chunk])
+	}
+}
+
+func Test_Patch(t *testing.T) {
+	patch, err := NewPatch(PatchID{}, 1, 1, RecipeListPatch{
+		"/foo": &Recipe{5, []ChunkID{NewChunkID([]byte("hello"))}},
+		"/bar": nil,
+	}, ChunkHoldersPatch{
+		MustParseNode("http://example.com"): ChunkPatch{
+			Add: []ChunkID{NewChunkID([]byte("hello"))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to make patch: %s", err.Error())
+	}
+
+	b, err := msgpack.Marshal(patch)
+	if err != nil {
+		t.Fatalf("failed to marshal to messagepack: %s", err.Error())
+	}
+
+	var patch2 Patch
+	if err = msgpack.Unmarshal(b, &patch2); err != nil {
+		t.Fatalf("failed to unmarshal from messagepack: %s", err.Error())
+	}
+	if patch2.ID != patch.ID {
+		t.Errorf("failed to unmarshal from messagepack: excepted %s but got %s", patch.ID, patch2.ID)
+	}
+
+	patch3, _ := NewPatch(PatchID{}, 2, 1, patch.Recipes, patch.Chunks)
+	if patch3.ID == patch.ID {
+		t.Errorf("patches of different term must have different ID")
+	}
+
+	added, deleted := patch2.RecipesNum()
+	if added != 1 || deleted != 1 {
+		t.Errorf("unexcepted number of recipes: excepted 1/1 but got %d/%d", added, deleted)
+	}
+
+	state := NewState()
+	state.Apply(patch2)
+
+	b, err = msgpack.Marshal(state)
+	if err != nil {
+		t.Fatalf("failed to marshal to messagepack: %s", err.Error())
+	}
+
+	var state2 State
+	if err = msgpack.Unmarshal(b, &state2); err != nil {
+		t.Fatalf("failed to unmarshal from messagepack: %s", err.Error())
+	}
+	if state2.ID != state.ID {
+		t.Errorf("failed to unmarshal from messagepack: excepted %s but got %s", state.ID, state2.ID)
+	}
+
+	state2.Term++
+	if calcStateID(&state2) == state.ID {
+		t.Errorf("state ID must depend on term")
+	}
+	state2.Term--
+	state2.Index++
+	if calcStateID(&state2) == state.ID {
+		t.Errorf("state ID must depend on index")
+	}
+}
+
+func Test_PatchChain(t *testing.T) {
+	var leader, follower PatchChain
+	leaderState := NewState()
+	followerState := NewState()
+
+	p1, _ := leader.New(1, RecipeListPatch{"/foo": &Recipe{1, []ChunkID{NewChunkID([]byte("a"))}}}, nil)
+	p2, _ := leader.New(1, RecipeListPatch{"/bar": &Recipe{1, []ChunkID{NewChunkID([]byte("b"))}}}, nil)
+
+	if err := follower.Add(p2); err != nil {
+		t.Fatalf("failed to add first patch: %s", err.Error())
+	}
+	if err := follower.ApplyTo(followerState, p2.ID); err == nil {
+		t.Errorf("must not apply patch that not chained to state")
+	}
+
+	follower = PatchChain{}
+	for _, p := range []Patch{p1, p2, p1} {
+		if err := follower.Add(p); err != nil {
+			t.Fatalf("failed to add patch: %s", err.Error())
+		}
+	}
+
+	if err := leader.ApplyTo(leaderState, p2.ID); err != nil {
+		t.Fatalf("failed to apply patch: %s", err.Error())
+	}
+	if err := follower.ApplyTo(followerState, p1.ID); err != nil {
+		t.Fatalf("failed to apply patch: %s", err.Error())
+	}
+	if len(followerState.Recipes) != 1 {
+		t.Errorf("unexcepted number of recipes: excepted 1 but got %d", len(followerState.Recipes))
+	}
+	if err := follower.ApplyTo(followerState, p2.ID); err != nil {
+		t.Fatalf("failed to apply patch: %s", err.Error())
+	}
+	if followerState.ID != leaderState.ID {
+		t.Errorf("state mismatch: leader is %s but follower is %s", leaderState, followerState)
+	}
+
+	p3, _ := leader.New(1, RecipeListPatch{"/baz": nil}, nil)
+	leader.Rollback(p3.ID)
+	if leader.Has(p3.ID) {
+		t.Errorf("rollbacked patch must be removed")
+	}
+
+	p4, _ := leader.New(1, RecipeListPatch{"/foo": nil}, nil)
+	if err := follower.Add(p3); err != nil {
+		t.Fatalf("failed to add patch: %s", err.Error())
+	}
+	if err := follower.Add(p4); err != nil {
+		t.Fatalf("failed to add patch: %s", err.Error())
+	}
+	if follower.Has(p3.ID) {
+		t.Errorf("conflicting patch must be removed")
+	}
+}
+
+func Test_PatchChain_Since(t *testing.T) {
+	var chain PatchChain
+	state := NewState()
+
+	patches := []Patch{}
+	for _, tag := range []string{"/a", "/b", "/c", "/d"} {
+		p, _ := chain.New(1, RecipeListPatch{tag: &Recipe{}}, nil)
+		patches = append(patches, p)
+	}
+
+	if err := chain.ApplyTo(state, patches[2].ID); err != nil {
+		t.Fatalf("failed to apply patch: %s", err.Error())
+	}
+
+	since, err := chain.Since(PatchID{}, state.PatchID)
+	if err != nil {
+		t.Fatalf("failed to get patches: %s", err.Error())
+	}
+	if len(since) != 3 {
+		t.Errorf("unexcepted number of patches: excepted 3 but got %d", len(since))
+	}
+
+	chain.Compact(state.PatchID, 2)
+
+	if _, err := chain.Since(PatchID{}, state.PatchID); err == nil {
+		t.Errorf("must not return compacted patches")
+	}
+
+	since, err = chain.Since(patches[0].ID, state.PatchID)
+	if err != nil {
+		t.Fatalf("failed to get patches: %s", err.Error())
+	}
+	if len(since) != 2 || since[0].ID != patches[1].ID || since[1].ID != patches[2].ID {
+		t.Errorf("unexcepted patches: %v", since)
+	}
+
+	chain.Reset(state)
+	p, _ := chain.New(1, RecipeListPatch{"/e": &Recipe{}}, nil)
+	if p.Previous != state.PatchID {
+		t.Errorf("new patch must chain to %s but got %s", state.PatchID, p.Previous)
+	}
+}
+
+func Test_PatchChain_Last(t *testing.T) {
+	var chain PatchChain
+	state := NewState()
+
+	if term, index := chain.Last(state); term != 0 || index != 0 {
+		t.Errorf("unexcepted last entry of empty chain: term=%d index=%d", term, index)
+	}
+
+	p1, _ := chain.New(1, RecipeListPatch{"/a": &Recipe{}}, nil)
+	p2, _ := chain.New(1, RecipeListPatch{"/b": &Recipe{}}, nil)
+	chain.New(2, RecipeListPatch{"/c": &Recipe{}}, nil)
+
+	if p1.Index != 1 || p2.Index != 2 {
+		t.Errorf("unexcepted patch index: excepted 1 and 2 but got %d and %d", p1.Index, p2.Index)
+	}
+
+	if term, index := chain.Last(state); term != 2 || index != 3 {
+		t.Errorf("unexcepted last entry: excepted term=2 index=3 but got term=%d index=%d", term, index)
+	}
+
+	if err := chain.ApplyTo(state, p1.ID); err != nil {
+		t.Fatalf("failed to apply patch: %s", err.Error())
+	}
+	if state.Index != 1 || state.Term != 1 {
+		t.Errorf("unexcepted state position: term=%d index=%d", state.Term, state.Index)
+	}
+	if term, index := chain.Last(state); term != 2 || index != 3 {
+		t.Errorf("unexcepted last entry: excepted term=2 index=3 but got term=%d index=%d", term, index)
+	}
+
+	chain.Reset(state)
+	if term, index := chain.Last(state); term != 1 || index != 1 {
+		t.Errorf("unexcepted last entry after reset: excepted term=1 index=1 but got term=%d index=%d", term, index)
+	}
+}
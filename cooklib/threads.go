@@ -2,55 +2,184 @@ package cooklib
 
 import (
 	"context"
+	"math/rand"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"fmt"
 )
 
+var (
+	ErrNotLeader         = fmt.Errorf("not leader")
+	ErrReplicationFailed = fmt.Errorf("failed to replicate")
+)
+
 type CookFS struct {
+	self   *Node
+	role   Role
 	leader *Node
 	term   int64
+	vote   Vote
 	state  *State
+	chain  PatchChain
+	lock   sync.Mutex
+
+	lastAlive   time.Time
+	leaderIndex int64
+	lease       time.Time
+
+	commitLock sync.Mutex
+	worker     WorkerPool
+	stopLeader context.CancelFunc
+	catchingUp int32
+	confirming int32
+	handingOff int32
+
+	syncingLearners int32
+
+	sinceCheckpoint int
 
-	Nodes   func() []*Node
-	Handler CommunicationHandler
-	Config  Config
+	touched     map[ChunkID]time.Time
+	touchedLock sync.Mutex
 
-	alive   chan *Node
+	Bootstrap func() []*Node
+	Handler   CommunicationHandler
+	Config    Config
+	Chunks    ChunkStore
+	Journal   *Journal
+
+	alive   chan AliveMessage
+	timeout chan struct{}
 	polling chan PollingTask
 }
 
 func NewCookFS(handler CommunicationHandler, nodes func() []*Node, config Config) *CookFS {
 	return &CookFS{
-		state:   NewState(),
-		Nodes:   nodes,
-		Handler: handler,
-		Config:  config,
-		alive:   make(chan *Node),
-		polling: make(chan PollingTask, len(nodes())*2),
+		self:      nodes()[0],
+		state:     NewState(),
+		Bootstrap: nodes,
+		Handler:   handler,
+		Config:    config,
+		Chunks:    NewMemoryChunkStore(),
+		touched:   make(map[ChunkID]time.Time),
+		alive:     make(chan AliveMessage, 1),
+		timeout:   make(chan struct{}, 1),
+		polling:   make(chan PollingTask, len(nodes())*2),
 	}
 }
 
 func (c *CookFS) AliveMessage(alive AliveMessage) Response {
-	if (c.leader.String() == alive.Leader.String() && c.term == alive.Term) || c.term < alive.Term {
-		c.alive <- alive.Leader
-		c.leader = alive.Leader
-		c.term = alive.Term
+	c.lock.Lock()
 
-		return Response{StatusCode: 200}
-	} else {
+	if c.term > alive.Term || (c.term == alive.Term && c.leader != nil && c.leader.String() != alive.Leader.String()) {
+		defer c.lock.Unlock()
+		return Response{409, AliveMessage{c.leader, c.term, c.state.PatchID, c.state.Index, c.priority()}}
+	}
+
+	if alive.Leader.String() != c.self.String() {
+		c.becomeFollower(alive.Term, alive.Leader)
+	}
+	c.lastAlive = time.Now()
+	c.leaderIndex = alive.Index
+
+	err := c.applyTo(alive.PatchID)
+
+	current := AliveMessage{c.leader, c.term, c.state.PatchID, c.state.Index, c.priority()}
+	handoff := alive.Leader.String() != c.self.String() && current.Priority > alive.Priority && current.Index >= alive.Index
+
+	c.lock.Unlock()
+
+	if err != nil {
+		go c.CatchUp(alive.Leader)
+	} else if handoff {
+		go c.requestHandoff(alive.Leader)
+	}
+
+	select {
+	case c.alive <- alive:
+	default:
+	}
+
+	return Response{200, current}
+}
+
+func (c *CookFS) grantVote(request PollRequest) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if request.Term < c.vote.Term {
+		return false
+	}
+	if request.Term == c.vote.Term && c.vote.Node.String() != request.Node.String() {
+		return false
+	}
+
+	previous := c.vote
+	c.vote = Vote{request.Term, request.Node}
+
+	if request.Term > c.term {
+		if request.Node.String() == c.self.String() {
+			c.term = request.Term
+		} else {
+			c.becomeFollower(request.Term, nil)
+		}
+	}
+
+	if err := c.persistTerm(); err != nil {
+		c.vote = previous
+		return false
+	}
+
+	return true
+}
+
+func (c *CookFS) isUpToDate(request PollRequest) bool {
+	lastTerm, lastIndex := c.chain.Last(c.state)
+	return request.LastTerm > lastTerm || (request.LastTerm == lastTerm && request.LastIndex >= lastIndex)
+}
+
+func (c *CookFS) PreVoteRequest(request PollRequest) Response {
+	if !c.IsMember(request.Node) || !c.IsMember(c.self) {
 		return Response{StatusCode: 409}
 	}
+
+	c.lock.Lock()
+	upToDate := c.isUpToDate(request)
+	heard := time.Since(c.lastAlive) < c.Config.LeaderDeathTimer && c.leader.String() != request.Node.String()
+	term := c.term
+	c.lock.Unlock()
+
+	if term < request.Term && upToDate && !heard {
+		return Response{StatusCode: 204}
+	}
+
+	return Response{StatusCode: 409}
 }
 
 func (c *CookFS) PollRequest(request PollRequest) Response {
-	if c.term <= request.Term && c.state.PatchID == request.PatchID {
-		accept := make(chan bool)
+	if !c.IsMember(request.Node) || !c.IsMember(c.self) {
+		return Response{StatusCode: 409}
+	}
+
+	c.lock.Lock()
+	upToDate := c.isUpToDate(request)
+	term := c.term
+	c.lock.Unlock()
+
+	if term <= request.Term && upToDate && request.Transfer {
+		if c.grantVote(request) {
+			return Response{StatusCode: 204}
+		}
+		return Response{StatusCode: 409}
+	} else if term <= request.Term && upToDate {
+		accept := make(chan bool, 1)
 		c.polling <- PollingTask{request, accept}
 
 		select {
 		case acc := <-accept:
-			if acc {
+			if acc && c.grantVote(request) {
 				return Response{StatusCode: 204}
 			} else {
 				return Response{StatusCode: 409}
@@ -64,6 +193,455 @@ func (c *CookFS) PollRequest(request PollRequest) Response {
 	}
 }
 
+func (c *CookFS) PutChunk(chunk Chunk) Response {
+	if NewChunkID(chunk.Data) != chunk.ID {
+		return Response{StatusCode: 400}
+	}
+
+	if err := c.storeChunk(chunk.ID, chunk.Data); err != nil {
+		return Response{StatusCode: 500}
+	}
+
+	return Response{200, c.self}
+}
+
+func (c *CookFS) GetChunk(id ChunkID) Response {
+	data, err := c.Chunks.Get(id)
+	if err == ErrNoSuchChunk {
+		return Response{StatusCode: 404}
+	} else if err != nil {
+		return Response{StatusCode: 500}
+	}
+
+	return Response{200, data}
+}
+
+func (c *CookFS) HasChunk(id ChunkID) Response {
+	if !c.Chunks.Has(id) {
+		return Response{StatusCode: 404}
+	}
+
+	return Response{StatusCode: 200}
+}
+
+func (c *CookFS) RecipeQuery(query RecipeQuery) Response {
+	lag, err := c.prepareRead(query.Consistency)
+	if err != nil {
+		return readError(err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	recipe, ok := c.state.Recipes[query.Tag]
+	if !ok {
+		return Response{StatusCode: 404}
+	}
+
+	holders := make(ChunkHolders)
+	for _, chunk := range recipe.Chunks {
+		if nodes, ok := c.state.ChunkHolders[chunk]; ok {
+			holders[chunk] = append([]*Node{}, nodes...)
+		}
+	}
+
+	return Response{200, RecipeInfo{query.Tag, recipe, holders, lag}}
+}
+
+func (c *CookFS) RecipeTags(query RecipeListQuery) Response {
+	if _, err := c.prepareRead(query.Consistency); err != nil {
+		return readError(err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tags := make([]string, 0, len(c.state.Recipes))
+	for tag := range c.state.Recipes {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	return Response{200, tags}
+}
+
+func (c *CookFS) Commit(recipes RecipeListPatch, chunks ChunkHoldersPatch) (Patch, error) {
+	return c.commit(Patch{Recipes: recipes, Chunks: chunks}, nil)
+}
+
+func (c *CookFS) newPatch(template Patch, validate func(*State) error) (Patch, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.role != Leader {
+		return Patch{}, ErrNotLeader
+	}
+
+	if validate != nil {
+		if err := validate(c.state); err != nil {
+			return Patch{}, err
+		}
+	}
+
+	patch, err := c.chain.Extend(c.term, template)
+	if err != nil {
+		return Patch{}, err
+	}
+
+	if err := c.persistPatch(patch); err != nil {
+		c.chain.Rollback(patch.ID)
+		return Patch{}, err
+	}
+
+	return patch, nil
+}
+
+func (c *CookFS) commit(template Patch, validate func(*State) error) (Patch, error) {
+	c.commitLock.Lock()
+	defer c.commitLock.Unlock()
+
+	patch, err := c.newPatch(template, validate)
+	if err != nil {
+		return Patch{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout)
+	defer cancel()
+
+	c.workers().SendOnly(ctx, c.Learners(), "/journal", patch, c.Config.CommitTimeout)
+
+	ok, responses := c.workers().Majority(ctx, c.Nodes(), "/journal", patch, c.Config.CommitTimeout)
+	if !ok {
+		c.lock.Lock()
+		c.chain.Rollback(patch.ID)
+		c.lock.Unlock()
+
+		fmt.Println("failed to replicate", patch)
+
+		for _, resp := range responses {
+			if alive, ok := resp.Data.(*AliveMessage); ok && alive.Term > patch.Term {
+				fmt.Println("found newer term", alive.Term)
+				c.stepDown(alive.Term, alive.Leader)
+				break
+			}
+		}
+
+		return Patch{}, ErrReplicationFailed
+	}
+
+	c.lock.Lock()
+	err = c.applyTo(patch.ID)
+	c.lock.Unlock()
+	if err != nil {
+		return Patch{}, err
+	}
+
+	fmt.Println("committed", patch)
+
+	return patch, nil
+}
+
+func (c *CookFS) CommitRequest(request CommitRequest) Response {
+	patch, err := c.Commit(request.Recipes, request.Chunks)
+	switch err {
+	case nil:
+		return Response{200, patch.ID}
+	case ErrNotLeader:
+		forwarded := request.Forwarded
+		request.Forwarded = true
+		return c.forwardToLeader("/commit", request, forwarded)
+	case ErrReplicationFailed:
+		return Response{StatusCode: 503}
+	default:
+		return Response{StatusCode: 500}
+	}
+}
+
+func (c *CookFS) forwardToLeader(path string, request interface{}, forwarded bool) Response {
+	c.lock.Lock()
+	leader := c.leader
+	redirect := Response{307, AliveMessage{leader, c.term, c.state.PatchID, c.state.Index, c.priority()}}
+	c.lock.Unlock()
+
+	if leader.String() == "" {
+		return Response{StatusCode: 503}
+	}
+	if forwarded || leader.String() == c.self.String() {
+		return redirect
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout*2)
+	defer cancel()
+
+	resp := c.Handler.Send(ctx, Request{leader, path, request, 0})
+	if resp.StatusCode == 502 {
+		return redirect
+	}
+
+	return resp
+}
+
+func (c *CookFS) Restore() error {
+	if c.Journal == nil {
+		return nil
+	}
+
+	state, records, err := c.Journal.load()
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.state = state
+	c.chain.Reset(state)
+
+	base := state.Index
+	checkpointed := make(map[PatchID]bool)
+
+	for _, r := range records {
+		switch {
+		case r.Term != nil:
+			c.term = *r.Term
+			if r.Vote != nil {
+				c.vote = *r.Vote
+			}
+
+		case r.Patch != nil && r.Patch.Index <= base:
+			checkpointed[r.Patch.ID] = true
+
+		case r.Commit != nil && (checkpointed[*r.Commit] || *r.Commit == c.state.PatchID):
+			continue
+
+		case r.Patch != nil:
+			if r.Patch.Previous != c.state.PatchID && !c.chain.Has(r.Patch.Previous) {
+				return fmt.Errorf("broken journal: unknown previous of %s", r.Patch)
+			}
+			if err := c.chain.Add(*r.Patch); err != nil {
+				return fmt.Errorf("broken journal: failed to add %s: %s", r.Patch, err.Error())
+			}
+
+		case r.Commit != nil:
+			if err := c.chain.ApplyTo(c.state, *r.Commit); err != nil {
+				return fmt.Errorf("broken journal: failed to apply %s: %s", *r.Commit, err.Error())
+			}
+		}
+	}
+
+	c.chain.Compact(c.state.PatchID, c.Config.PatchRetention)
+
+	fmt.Println("restored", c.state, "at term", c.term)
+
+	return nil
+}
+
+func (c *CookFS) persistTerm() error {
+	if c.Journal == nil {
+		return nil
+	}
+
+	err := c.Journal.AppendTerm(c.term, c.vote)
+	if err != nil {
+		fmt.Println("failed to write term:", err.Error())
+	}
+	return err
+}
+
+func (c *CookFS) persistPatch(patch Patch) error {
+	if c.Journal == nil {
+		return nil
+	}
+
+	return c.Journal.AppendPatch(patch)
+}
+
+func (c *CookFS) checkpoint() {
+	c.sinceCheckpoint = 0
+
+	if c.Journal == nil {
+		return
+	}
+
+	if err := c.Journal.Checkpoint(c.state, c.term, c.vote, c.chain.After(c.state.PatchID)); err != nil {
+		fmt.Println("failed to write checkpoint:", err.Error())
+	}
+}
+
+func (c *CookFS) applyTo(id PatchID) error {
+	previous := c.state.PatchID
+
+	if err := c.chain.ApplyTo(c.state, id); err != nil {
+		return err
+	}
+
+	c.chain.Compact(c.state.PatchID, c.Config.PatchRetention)
+
+	if c.Journal != nil && c.state.PatchID != previous {
+		if err := c.Journal.AppendCommit(c.state.PatchID); err != nil {
+			fmt.Println("failed to write commit:", err.Error())
+		}
+
+		c.sinceCheckpoint++
+		if c.sinceCheckpoint >= c.Config.CheckpointInterval {
+			c.checkpoint()
+		}
+	}
+
+	return nil
+}
+
+func (c *CookFS) JournalSince(id PatchID) Response {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	patches, err := c.chain.Since(id, c.state.PatchID)
+	if err != nil {
+		return Response{StatusCode: 410}
+	}
+
+	return Response{200, patches}
+}
+
+func (c *CookFS) Snapshot() Response {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return Response{200, c.state.Copy()}
+}
+
+func (c *CookFS) replayJournal(ctx context.Context, leader *Node) bool {
+	c.lock.Lock()
+	base := c.state.PatchID
+	c.lock.Unlock()
+
+	resp := c.Handler.Send(ctx, Request{leader, "/journal/since", base, c.Config.CommitTimeout})
+	if resp.StatusCode != 200 {
+		return false
+	}
+	data, ok := resp.Data.(*[]Patch)
+	if !ok {
+		return false
+	}
+	patches := *data
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.state.PatchID != base || len(patches) == 0 {
+		return true
+	}
+
+	for _, p := range patches {
+		if c.chain.Has(p.ID) {
+			continue
+		}
+
+		if err := c.chain.Add(p); err != nil {
+			return false
+		}
+
+		if err := c.persistPatch(p); err != nil {
+			c.chain.Rollback(p.ID)
+			return false
+		}
+	}
+
+	if err := c.applyTo(patches[len(patches)-1].ID); err != nil {
+		return false
+	}
+
+	fmt.Println("caught up to", c.state.PatchID, "by", len(patches), "patches")
+
+	return true
+}
+
+func (c *CookFS) installSnapshot(ctx context.Context, leader *Node) bool {
+	resp := c.Handler.Send(ctx, Request{leader, "/state", nil, c.Config.CommitTimeout})
+	if resp.StatusCode != 200 {
+		return false
+	}
+	state, ok := resp.Data.(*State)
+	if !ok || state == nil {
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.state = state
+	c.chain.Reset(state)
+	c.checkpoint()
+
+	fmt.Println("installed snapshot", state)
+
+	return true
+}
+
+func (c *CookFS) CatchUp(leader *Node) {
+	if !atomic.CompareAndSwapInt32(&c.catchingUp, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.catchingUp, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout)
+	defer cancel()
+
+	if c.replayJournal(ctx, leader) {
+		return
+	}
+
+	if !c.installSnapshot(ctx, leader) {
+		fmt.Println("failed to catch up with", leader)
+	}
+}
+
+func (c *CookFS) JournalPatch(patch Patch) Response {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if patch.Term < c.term {
+		fmt.Println("reject patch from deposed leader", patch)
+		return Response{409, AliveMessage{c.leader, c.term, c.state.PatchID, c.state.Index, c.priority()}}
+	}
+
+	if c.chain.Has(patch.ID) {
+		return Response{StatusCode: 200}
+	}
+
+	if patch.Index <= c.state.Index {
+		fmt.Println("reject patch conflicting with committed history", patch)
+		return Response{StatusCode: 409}
+	}
+
+	previous := c.state.Index
+	if patch.Previous != c.state.PatchID {
+		p, ok := c.chain.Get(patch.Previous)
+		if !ok {
+			return Response{StatusCode: 409}
+		}
+		previous = p.Index
+	}
+	if patch.Index != previous+1 {
+		return Response{StatusCode: 400}
+	}
+
+	if _, last := c.chain.Last(c.state); last >= patch.Index {
+		fmt.Println("truncate patches conflicting with", patch)
+	}
+
+	if err := c.chain.Add(patch); err != nil {
+		return Response{StatusCode: 409}
+	}
+
+	if err := c.persistPatch(patch); err != nil {
+		c.chain.Rollback(patch.ID)
+		return Response{StatusCode: 500}
+	}
+
+	return Response{StatusCode: 200}
+}
+
 func (c *CookFS) HandleRequest(request Request) Response {
 	if request.Data != nil {
 		switch request.Path {
@@ -73,13 +651,58 @@ func (c *CookFS) HandleRequest(request Request) Response {
 		case "/term/poll":
 			return c.PollRequest(*request.Data.(*PollRequest))
 
+		case "/term/prevote":
+			return c.PreVoteRequest(*request.Data.(*PollRequest))
+
+		case "/journal":
+			return c.JournalPatch(*request.Data.(*Patch))
+
+		case "/journal/since":
+			return c.JournalSince(*request.Data.(*PatchID))
+
+		case "/commit":
+			return c.CommitRequest(*request.Data.(*CommitRequest))
+
+		case "/replicate":
+			return c.ReplicateRequest(*request.Data.(*ReplicateRequest))
+
+		case "/member":
+			return c.MemberRequest(*request.Data.(*MemberRequest))
+
+		case "/term/transfer":
+			return c.TransferRequest(*request.Data.(*TransferRequest))
+
+		case "/term/timeout":
+			return c.TimeoutNow(*request.Data.(*AliveMessage))
+
+		case "/recipe":
+			return c.RecipeQuery(*request.Data.(*RecipeQuery))
+
+		case "/recipe/list":
+			return c.RecipeTags(*request.Data.(*RecipeListQuery))
+
 		default:
 			return Response{StatusCode: 404}
 		}
 	} else {
 		switch request.Path {
 		case "/term":
-			return Response{200, AliveMessage{c.leader, c.term, c.state.PatchID}}
+			c.lock.Lock()
+			defer c.lock.Unlock()
+
+			return Response{200, AliveMessage{c.leader, c.term, c.state.PatchID, c.state.Index, c.priority()}}
+
+		case "/state":
+			return c.Snapshot()
+
+		case "/journal/index":
+			return c.ReadIndexRequest()
+
+		case "/recipe/list":
+			return c.RecipeTags(RecipeListQuery{})
+
+		case "/member/list":
+			return Response{200, c.Membership()}
 
 		default:
 			return Response{StatusCode: 404}
@@ -87,23 +710,67 @@ func (c *CookFS) HandleRequest(request Request) Response {
 	}
 }
 
+func (c *CookFS) electionTimeout() time.Duration {
+	wait := c.Config.LeaderDeathTimer + c.Config.CandidacyWaitMin
+	if spread := (c.Config.CandidacyWaitMax - c.Config.CandidacyWaitMin) / time.Duration(c.Config.Priority+1); spread > 0 {
+		wait += time.Duration(rand.Int63n(int64(spread)))
+	}
+	return wait
+}
+
+func (c *CookFS) priority() int {
+	if c.Config.NeverLeader || !hasNode(c.members(), c.self) {
+		return -1
+	}
+	return c.Config.Priority
+}
+
+func (c *CookFS) workers() WorkerPool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.worker
+}
+
 func (c *CookFS) RunFollower(ctx context.Context) {
 	var cancelCandidacy context.CancelFunc
 
+	c.lock.Lock()
+	c.worker = NewWorkerPool(ctx, c.Handler, c.Config.SendWorkersNum)
+	c.lock.Unlock()
+
 	go PollingConsiliator(ctx, c.polling, c.Config.PollingWindow)
+	go c.RunOrphanGC(ctx)
 
 	for {
 		select {
-		case leader := <-c.alive:
-			if leader.String() != c.Nodes()[0].String() && cancelCandidacy != nil {
+		case alive := <-c.alive:
+			if alive.Leader.String() != c.self.String() && alive.Term >= c.Term() && cancelCandidacy != nil {
 				cancelCandidacy()
 				cancelCandidacy = nil
 			}
 
-		case <-time.After(c.Config.LeaderDeathTimer):
+		case <-time.After(c.electionTimeout()):
+			if c.Config.NeverLeader || !c.IsMember(c.self) {
+				continue
+			}
+
+			if cancelCandidacy != nil {
+				cancelCandidacy()
+			}
+
 			var ctx2 context.Context
 			ctx2, cancelCandidacy = context.WithCancel(ctx)
-			go c.RunCandidacy(ctx2)
+			go c.RunCandidacy(ctx2, false)
+
+		case <-c.timeout:
+			if cancelCandidacy != nil {
+				cancelCandidacy()
+			}
+
+			var ctx2 context.Context
+			ctx2, cancelCandidacy = context.WithCancel(ctx)
+			go c.RunCandidacy(ctx2, true)
 
 		case <-ctx.Done():
 			return
@@ -111,38 +778,173 @@ func (c *CookFS) RunFollower(ctx context.Context) {
 	}
 }
 
-func (c *CookFS) RunCandidacy(ctx context.Context) {
-	fmt.Println("been candidacy of term", c.term+1)
+func (c *CookFS) RunCandidacy(ctx context.Context, transfer bool) {
+	worker := NewWorkerPool(ctx, c.Handler, c.Config.SendWorkersNum)
+
+	c.lock.Lock()
+	lastTerm, lastIndex := c.chain.Last(c.state)
+	msg := PollRequest{c.self, c.nextTerm(), lastTerm, lastIndex, c.Config.Priority, transfer}
+	if transfer {
+		msg.Term = c.term
+	}
+	c.lock.Unlock()
 
-	withTimeout, _ := context.WithTimeout(ctx, c.Config.CandidacyTimeout)
+	if !transfer {
+		withTimeout, cancel := context.WithTimeout(ctx, c.Config.CandidacyTimeout)
+		ok := worker.OverHalf(withTimeout, c.Nodes(), "/term/prevote", msg, c.Config.CandidacyTimeout)
+		cancel()
+		if !ok {
+			return
+		}
+	}
 
-	worker := NewWorkerPool(ctx, c.Handler, c.Config.SendWorkersNum)
+	c.lock.Lock()
+	var ok bool
+	if transfer {
+		ok = c.role == Candidate && c.term == msg.Term
+	} else {
+		ok = c.becomeCandidate()
+	}
+	c.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	fmt.Println("been candidacy of term", msg.Term)
+
+	poll, cancel := context.WithTimeout(ctx, c.Config.CandidacyTimeout)
+	ok = worker.OverHalf(poll, c.Nodes(), "/term/poll", msg, c.Config.CandidacyTimeout)
+	cancel()
 
-	msg := PollRequest{c.Nodes()[0], c.term + 1, c.state.PatchID}
+	c.lock.Lock()
+	if ok {
+		ok = c.becomeLeader(msg.Term)
+	}
+	if !ok && c.role == Candidate {
+		c.role = Follower
+	}
+	c.lock.Unlock()
+
+	if ok {
+		c.RunLeader(ctx)
+	}
+}
+
+func (c *CookFS) stepDown(term int64, leader *Node) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.role != Leader {
+		return
+	}
+
+	fmt.Println("step down from leader of term", c.term)
+
+	if term < c.term {
+		term = c.term
+	}
+	c.becomeFollower(term, leader)
+}
+
+func (c *CookFS) confirmTerm() {
+	if !atomic.CompareAndSwapInt32(&c.confirming, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.confirming, 0)
 
-	if worker.OverHalf(withTimeout, c.Nodes(), "/term/poll", msg, c.Config.CandidacyTimeout) {
-		c.term++
-		c.leader = c.Nodes()[0]
-		c.RunLeader(ctx, worker)
+	c.lock.Lock()
+	confirmed := c.state.Term == c.term
+	c.lock.Unlock()
+
+	if !confirmed {
+		c.Commit(nil, nil)
 	}
 }
 
-func (c *CookFS) RunLeader(ctx context.Context, worker WorkerPool) {
-	fmt.Println("been leader of term", c.term)
+func (c *CookFS) RunLeader(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.lock.Lock()
+	if c.role != Leader {
+		c.lock.Unlock()
+		return
+	}
+	c.stopLeader = cancel
+	c.lock.Unlock()
+
+	worker := NewWorkerPool(ctx, c.Handler, c.Config.SendWorkersNum)
+
+	acked := make(chan time.Time)
+	newer := make(chan AliveMessage)
 
 	sendAlive := func() {
-		msg := AliveMessage{c.Nodes()[0], c.term, c.state.PatchID}
-		worker.SendOnly(ctx, c.Nodes(), "/term", msg, c.Config.AliveTimeout)
+		sentAt := time.Now()
+
+		c.lock.Lock()
+		msg := AliveMessage{c.self, c.term, c.state.PatchID, c.state.Index, c.priority()}
+		c.lock.Unlock()
+
+		go c.syncLearners(ctx, worker, msg)
+
+		nodes := c.Nodes()
+		acks := 0
+		for _, resp := range worker.SendAll(ctx, nodes, "/term", msg, c.Config.AliveTimeout) {
+			if resp.StatusCode == 200 {
+				acks++
+			} else if alive, ok := resp.Data.(*AliveMessage); ok && alive.Term > msg.Term {
+				select {
+				case newer <- *alive:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+
+		if acks > len(nodes)/2 {
+			select {
+			case acked <- sentAt:
+			case <-ctx.Done():
+			}
+		}
 	}
 
 	go sendAlive()
+	go c.confirmTerm()
+	go c.RunRepair(ctx)
+	go c.RunGC(ctx)
+
+	ticker := time.NewTicker(c.Config.AliveInterval)
+	defer ticker.Stop()
 
-	interval := time.Tick(c.Config.AliveInterval)
+	lastQuorum := time.Now()
 
 	for {
 		select {
-		case <-interval:
+		case <-ticker.C:
+			if c.Role() != Leader {
+				return
+			}
+
+			if time.Since(lastQuorum) > c.Config.LeaderDeathTimer {
+				fmt.Println("lost quorum")
+				c.stepDown(0, nil)
+				return
+			}
+
 			go sendAlive()
+			go c.confirmTerm()
+
+		case t := <-acked:
+			if t.After(lastQuorum) {
+				lastQuorum = t
+			}
+			c.extendLease(t)
+
+		case alive := <-newer:
+			fmt.Println("found newer term", alive.Term)
+			c.stepDown(alive.Term, alive.Leader)
+			return
 
 		case <-ctx.Done():
 			return
@@ -203,18 +1005,54 @@ func (w WorkerPool) SendOnly(ctx context.Context, nodes []*Node, path string, da
 	}
 }
 
+func (w WorkerPool) SendAll(ctx context.Context, nodes []*Node, path string, data interface{}, timeout time.Duration) []Response {
+	response := make(chan Response, len(nodes))
+
+	for _, node := range nodes {
+		select {
+		case w.task <- WorkerTask{Request{node, path, data, timeout}, response}:
+		case <-ctx.Done():
+			return nil
+		case <-w.ctx.Done():
+			return nil
+		}
+	}
+
+	responses := make([]Response, 0, len(nodes))
+	for range nodes {
+		select {
+		case resp := <-response:
+			responses = append(responses, resp)
+		case <-ctx.Done():
+			return responses
+		case <-w.ctx.Done():
+			return responses
+		}
+	}
+
+	return responses
+}
+
 func (w WorkerPool) OverHalf(ctx context.Context, nodes []*Node, path string, data interface{}, timeout time.Duration) bool {
+	ok, _ := w.Majority(ctx, nodes, path, data, timeout)
+	return ok
+}
+
+func (w WorkerPool) Majority(ctx context.Context, nodes []*Node, path string, data interface{}, timeout time.Duration) (bool, []Response) {
 	response := make(chan Response, len(nodes))
 
 	for _, node := range nodes {
 		w.task <- WorkerTask{Request{node, path, data, timeout}, response}
 	}
 
+	responses := make([]Response, 0, len(nodes))
 	allow := 0
 	deny := 0
 	for range nodes {
 		select {
 		case resp := <-response:
+			responses = append(responses, resp)
+
 			if resp.StatusCode == 200 || resp.StatusCode == 204 {
 				allow++
 			} else {
@@ -222,19 +1060,19 @@ func (w WorkerPool) OverHalf(ctx context.Context, nodes []*Node, path string, da
 			}
 
 			if allow > len(nodes)/2 {
-				return true
+				return true, responses
 			} else if deny > len(nodes)/2 {
-				return false
+				return false, responses
 			}
 
 		case <-ctx.Done():
-			return false
+			return false, responses
 		case <-w.ctx.Done():
-			return false
+			return false, responses
 		}
 	}
 
-	return false
+	return false, responses
 }
 
 type PollingTask struct {
@@ -242,6 +1080,13 @@ type PollingTask struct {
 	accept  chan bool
 }
 
+func preferCandidate(a, b PollRequest) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return strings.Compare(a.Node.String(), b.Node.String()) < 0
+}
+
 func PollingConsiliator(ctx context.Context, ch chan PollingTask, windowDuration time.Duration) {
 	var window context.Context
 	var candidate PollingTask
@@ -264,7 +1109,7 @@ func PollingConsiliator(ctx context.Context, ch chan PollingTask, windowDuration
 				candidate = task
 			} else {
 				tasks = append(tasks, task)
-				if strings.Compare(task.request.Node.String(), candidate.request.Node.String()) < 0 {
+				if preferCandidate(task.request, candidate.request) {
 					candidate = task
 				}
 			}
@@ -0,0 +1,242 @@
+package cooklib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_electionTimeout(t *testing.T) {
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790")} }
+	c := NewCookFS(nil, nodes, DefaultConfig)
+
+	min := c.Config.LeaderDeathTimer + c.Config.CandidacyWaitMin
+	max := c.Config.LeaderDeathTimer + c.Config.CandidacyWaitMax
+
+	for i := 0; i < 100; i++ {
+		if d := c.electionTimeout(); d < min || d >= max {
+			t.Fatalf("election timeout out of range: %s", d)
+		}
+	}
+
+	c.Config.Priority = 3
+	max = c.Config.LeaderDeathTimer + c.Config.CandidacyWaitMin + (c.Config.CandidacyWaitMax-c.Config.CandidacyWaitMin)/4
+
+	for i := 0; i < 100; i++ {
+		if d := c.electionTimeout(); d < min || d >= max {
+			t.Fatalf("election timeout of prior node out of range: %s", d)
+		}
+	}
+}
+
+func Test_PreVoteRequest(t *testing.T) {
+	leader := MustParseNode("http://leader.com")
+	candidate := MustParseNode("http://candidate.com")
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790"), leader, candidate} }
+
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.term = 1
+	c.leader = leader
+
+	if resp := c.PreVoteRequest(PollRequest{candidate, 2, 0, 0, 0, false}); resp.StatusCode != 204 {
+		t.Errorf("must accept pre-vote when leader is dead: %d", resp.StatusCode)
+	}
+
+	c.lastAlive = time.Now()
+	if resp := c.PreVoteRequest(PollRequest{candidate, 2, 0, 0, 0, false}); resp.StatusCode != 409 {
+		t.Errorf("must reject pre-vote while leader is alive: %d", resp.StatusCode)
+	}
+
+	c.lastAlive = time.Time{}
+	c.chain.New(1, RecipeListPatch{"/foo": &Recipe{}}, nil)
+	if resp := c.PreVoteRequest(PollRequest{candidate, 2, 0, 0, 0, false}); resp.StatusCode != 409 {
+		t.Errorf("must reject pre-vote from outdated candidate: %d", resp.StatusCode)
+	}
+	if resp := c.PreVoteRequest(PollRequest{candidate, 2, 1, 1, 0, false}); resp.StatusCode != 204 {
+		t.Errorf("must accept pre-vote from up-to-date candidate: %d", resp.StatusCode)
+	}
+	if c.term != 1 || c.vote.Term != 0 {
+		t.Errorf("pre-vote must not change term or vote")
+	}
+}
+
+func Test_TimeoutNow(t *testing.T) {
+	self := MustParseNode("http://localhost:5790")
+	leader := MustParseNode("http://leader.com")
+	other := MustParseNode("http://other.com")
+	nodes := func() []*Node { return []*Node{self, leader, other} }
+
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.term = 1
+	c.leader = leader
+
+	if resp := c.TimeoutNow(AliveMessage{Leader: other, Term: 1}); resp.StatusCode != 409 {
+		t.Errorf("must reject timeout from non-leader: %d", resp.StatusCode)
+	}
+
+	if resp := c.TimeoutNow(AliveMessage{Leader: leader, Term: 1}); resp.StatusCode != 204 {
+		t.Fatalf("must accept timeout from leader: %d", resp.StatusCode)
+	}
+	if c.term != 2 || c.role != Candidate || c.leader != nil {
+		t.Errorf("must be candidate of next term: term=%d role=%s leader=%s", c.term, c.role, c.leader)
+	}
+
+	if resp := c.AliveMessage(AliveMessage{Leader: leader, Term: 1}); resp.StatusCode != 409 {
+		t.Errorf("must reject alive of previous leader: %d", resp.StatusCode)
+	}
+
+	if resp := c.PollRequest(PollRequest{self, 2, 0, 0, 0, true}); resp.StatusCode != 204 {
+		t.Errorf("must grant transfer poll: %d", resp.StatusCode)
+	}
+	if resp := c.PollRequest(PollRequest{other, 2, 0, 0, 0, true}); resp.StatusCode != 409 {
+		t.Errorf("must reject competing poll of same term: %d", resp.StatusCode)
+	}
+}
+
+func Test_stepDown(t *testing.T) {
+	self := MustParseNode("http://localhost:5790")
+	other := MustParseNode("http://other.com")
+	nodes := func() []*Node { return []*Node{self, other} }
+
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.term = 1
+	c.leader = self
+	c.role = Leader
+
+	c.stepDown(0, nil)
+	if c.leader != nil || c.term != 1 {
+		t.Errorf("must forget leadership on lost quorum: leader=%s term=%d", c.leader, c.term)
+	}
+
+	if c.role != Follower {
+		t.Errorf("must be follower after step down: %s", c.role)
+	}
+
+	c.leader = self
+	c.role = Leader
+	c.stepDown(2, other)
+	if c.leader != other || c.term != 2 || c.role != Follower {
+		t.Errorf("must follow newer term: leader=%s term=%d role=%s", c.leader, c.term, c.role)
+	}
+}
+
+func Test_grantVote(t *testing.T) {
+	self := MustParseNode("http://localhost:5790")
+	leader := MustParseNode("http://leader.com")
+	candidate := MustParseNode("http://candidate.com")
+	nodes := func() []*Node { return []*Node{self, leader, candidate} }
+
+	c := NewCookFS(nil, nodes, DefaultConfig)
+	c.term = 1
+	c.leader = leader
+
+	var chain PatchChain
+	stale, _ := chain.New(1, RecipeListPatch{"/foo": &Recipe{}}, nil)
+
+	if !c.grantVote(PollRequest{candidate, 2, 0, 0, 0, false}) {
+		t.Fatalf("must grant vote of newer term")
+	}
+	if c.term != 2 || c.leader != nil || c.role != Follower {
+		t.Errorf("must follow term of granted vote: term=%d leader=%s role=%s", c.term, c.leader, c.role)
+	}
+
+	if resp := c.JournalPatch(stale); resp.StatusCode != 409 {
+		t.Errorf("must reject patch of previous term after vote: %d", resp.StatusCode)
+	}
+	if resp := c.AliveMessage(AliveMessage{Leader: leader, Term: 1}); resp.StatusCode != 409 {
+		t.Errorf("must reject alive of previous term after vote: %d", resp.StatusCode)
+	}
+
+	c.role = Candidate
+	if !c.grantVote(PollRequest{self, 3, 0, 0, 0, false}) {
+		t.Fatalf("must grant vote for self")
+	}
+	if c.term != 3 || c.role != Candidate {
+		t.Errorf("must stay candidate after voting for self: term=%d role=%s", c.term, c.role)
+	}
+}
+
+func Test_PollingConsiliator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan PollingTask, 3)
+	go PollingConsiliator(ctx, ch, 50*time.Millisecond)
+
+	a := PollingTask{PollRequest{Node: MustParseNode("http://a.com"), Term: 2}, make(chan bool, 1)}
+	b := PollingTask{PollRequest{Node: MustParseNode("http://b.com"), Term: 2, Priority: 1}, make(chan bool, 1)}
+	c := PollingTask{PollRequest{Node: MustParseNode("http://c.com"), Term: 2, Priority: 1}, make(chan bool, 1)}
+	ch <- a
+	ch <- c
+	ch <- b
+
+	for _, x := range []struct {
+		task   PollingTask
+		accept bool
+	}{{a, false}, {b, true}, {c, false}} {
+		select {
+		case accept := <-x.task.accept:
+			if accept != x.accept {
+				t.Errorf("unexcepted result for %s: %v", x.task.request.Node, accept)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no result for %s", x.task.request.Node)
+		}
+	}
+}
+
+type stubHandler struct {
+	memoryHandler
+	send func(Request) Response
+}
+
+func (h stubHandler) Send(ctx context.Context, req Request) Response {
+	return h.send(req)
+}
+
+func Test_CatchUp_InvalidData(t *testing.T) {
+	leader := MustParseNode("http://leader.com")
+	nodes := func() []*Node { return []*Node{MustParseNode("http://localhost:5790"), leader} }
+
+	c := NewCookFS(stubHandler{send: func(Request) Response { return Response{StatusCode: 200} }}, nodes, DefaultConfig)
+	state := c.state
+
+	if c.replayJournal(context.Background(), leader) {
+		t.Errorf("must fail to replay undecodable journal")
+	}
+	if c.installSnapshot(context.Background(), leader) {
+		t.Errorf("must fail to install undecodable snapshot")
+	}
+	if c.state != state {
+		t.Errorf("state must not be changed by failed catch up")
+	}
+}
+
+func Test_commit_Deposed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	self := MustParseNode("http://localhost:5790")
+	newer := MustParseNode("http://newer.com")
+	nodes := func() []*Node { return []*Node{self, newer, MustParseNode("http://other.com")} }
+
+	handler := stubHandler{send: func(req Request) Response {
+		if req.Node.String() == self.String() {
+			return Response{StatusCode: 200}
+		}
+		return Response{409, &AliveMessage{Leader: newer, Term: 2}}
+	}}
+
+	c := NewCookFS(handler, nodes, DefaultConfig)
+	c.worker = NewWorkerPool(ctx, handler, 3)
+	c.term = 1
+	c.leader = self
+	c.role = Leader
+
+	if _, err := c.Commit(RecipeListPatch{"/foo": &Recipe{}}, nil); err != ErrReplicationFailed {
+		t.Errorf("must fail to commit on deposed leader: %v", err)
+	}
+	if c.Role() != Follower || c.Term() != 2 || c.Leader() != newer {
+		t.Errorf("must follow newer term: role=%s term=%d leader=%s", c.Role(), c.Term(), c.Leader())
+	}
+}
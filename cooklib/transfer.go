@@ -0,0 +1,163 @@
+package cooklib
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNotMember      = fmt.Errorf("not a member")
+	ErrTransferFailed = fmt.Errorf("failed to transfer leadership")
+	ErrLowerPriority  = fmt.Errorf("lower priority than leader")
+)
+
+func (c *CookFS) aliveMessage() AliveMessage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return AliveMessage{c.leader, c.term, c.state.PatchID, c.state.Index, c.priority()}
+}
+
+func (c *CookFS) syncFollower(ctx context.Context, node *Node) (int, bool) {
+	for {
+		msg := c.aliveMessage()
+
+		c.Handler.Send(ctx, Request{node, "/term", msg, c.Config.AliveTimeout})
+
+		resp := c.Handler.Send(ctx, Request{node, "/term", nil, c.Config.AliveTimeout})
+		if alive, ok := resp.Data.(*AliveMessage); ok && resp.StatusCode == 200 && alive.Index >= msg.Index {
+			return alive.Priority, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, false
+		case <-time.After(c.Config.AliveInterval):
+		}
+	}
+}
+
+func (c *CookFS) TransferLeadership(node *Node) error {
+	return c.transferLeadership(node, false)
+}
+
+func (c *CookFS) transferLeadership(node *Node, handoff bool) error {
+	c.commitLock.Lock()
+	defer c.commitLock.Unlock()
+
+	if c.Role() != Leader {
+		return ErrNotLeader
+	}
+	if node.String() == c.self.String() {
+		return nil
+	}
+	if !c.IsMember(node) {
+		return ErrNotMember
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout)
+	defer cancel()
+
+	priority, ok := c.syncFollower(ctx, node)
+	if !ok {
+		return ErrTransferFailed
+	}
+	if handoff && priority < c.Config.Priority {
+		return ErrLowerPriority
+	}
+
+	msg := c.aliveMessage()
+	if msg.Leader.String() != c.self.String() {
+		return ErrNotLeader
+	}
+
+	fmt.Println("transfer leadership to", node)
+	c.stepDown(0, nil)
+
+	if resp := c.Handler.Send(ctx, Request{node, "/term/timeout", msg, c.Config.AliveTimeout}); resp.StatusCode != 204 {
+		return ErrTransferFailed
+	}
+
+	return nil
+}
+
+func (c *CookFS) waitLeader(ctx context.Context, node *Node) bool {
+	for c.Leader().String() != node.String() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(c.Config.AliveInterval):
+		}
+	}
+	return true
+}
+
+func (c *CookFS) TransferRequest(request TransferRequest) Response {
+	err := c.transferLeadership(request.Node, request.Handoff)
+	switch err {
+	case nil:
+		ctx, cancel := context.WithTimeout(context.Background(), c.Config.CandidacyTimeout*2)
+		defer cancel()
+
+		if !c.waitLeader(ctx, request.Node) {
+			return Response{StatusCode: 503}
+		}
+		return Response{200, c.aliveMessage()}
+	case ErrNotLeader:
+		forwarded := request.Forwarded
+		request.Forwarded = true
+		return c.forwardToLeader("/term/transfer", request, forwarded)
+	case ErrNotMember:
+		return Response{StatusCode: 400}
+	case ErrLowerPriority:
+		return Response{StatusCode: 409}
+	case ErrTransferFailed:
+		return Response{StatusCode: 503}
+	default:
+		return Response{StatusCode: 500}
+	}
+}
+
+func (c *CookFS) requestHandoff(leader *Node) {
+	if !atomic.CompareAndSwapInt32(&c.handingOff, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.handingOff, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.CommitTimeout+c.Config.CandidacyTimeout*2)
+	defer cancel()
+
+	fmt.Println("request leadership from lower priority leader", leader)
+
+	if resp := c.Handler.Send(ctx, Request{leader, "/term/transfer", TransferRequest{c.self, true, true}, 0}); resp.StatusCode != 200 {
+		time.Sleep(c.Config.LeaderDeathTimer)
+	}
+}
+
+func (c *CookFS) TimeoutNow(alive AliveMessage) Response {
+	if c.Config.NeverLeader || !c.IsMember(c.self) {
+		return Response{StatusCode: 409}
+	}
+
+	c.lock.Lock()
+	current := c.role == Follower && c.term == alive.Term && c.leader.String() == alive.Leader.String()
+	if current {
+		c.becomeCandidate()
+		c.setTerm(c.nextTerm())
+		c.leader = nil
+	}
+	c.lock.Unlock()
+
+	if !current {
+		return Response{StatusCode: 409}
+	}
+
+	select {
+	case c.timeout <- struct{}{}:
+	default:
+	}
+
+	return Response{StatusCode: 204}
+}
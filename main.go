@@ -3,28 +3,192 @@ package main
 import (
 	"os"
 	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/go-yaml/yaml"
 
 	"github.com/macrat/cookfs/cooklib"
 	"github.com/macrat/cookfs/plugins"
 )
 
-func Nodes() []*cooklib.Node {
-	ns := []*cooklib.Node{}
+type FileConfig struct {
+	cooklib.Config `yaml:",inline"`
+
+	DataDir   string   `yaml:"data_dir"`
+	Listen    string   `yaml:"listen"`
+	Advertise string   `yaml:"advertise"`
+	Peers     []string `yaml:"peers"`
+}
+
+func LoadConfig(path string, config *FileConfig) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return yaml.UnmarshalStrict(raw, config)
+}
+
+func setByUser(flag *kingpin.FlagClause) *bool {
+	set := false
+	flag.Action(func(*kingpin.ParseContext) error {
+		set = true
+		return nil
+	})
+	return &set
+}
+
+func durationFlag(name, help string, target *time.Duration) func() {
+	flag := kingpin.Flag(name, help).PlaceHolder(target.String())
+	set := setByUser(flag)
+	v := flag.Duration()
+	return func() {
+		if *set {
+			*target = *v
+		}
+	}
+}
+
+func intFlag(name, help string, target *int) func() {
+	flag := kingpin.Flag(name, help).PlaceHolder(fmt.Sprint(*target))
+	set := setByUser(flag)
+	v := flag.Int()
+	return func() {
+		if *set {
+			*target = *v
+		}
+	}
+}
+
+func boolFlag(name, help string, target *bool) func() {
+	flag := kingpin.Flag(name, help)
+	set := setByUser(flag)
+	v := flag.Bool()
+	return func() {
+		if *set {
+			*target = *v
+		}
+	}
+}
 
-	for _, x := range os.Args[1:] {
-		ns = append(ns, cooklib.MustParseNode(x))
+func setString(v string, target *string) {
+	if v != "" {
+		*target = v
 	}
+}
 
-	return ns
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
 }
 
 func main() {
 	ctx := context.Background()
 
+	config := FileConfig{Config: cooklib.DefaultConfig, DataDir: "data"}
+	c := &config.Config
+
+	configFile := kingpin.Flag("config", "Path to YAML configuration file.").Short('c').ExistingFile()
+
+	dataDir := kingpin.Flag("data-dir", "Directory to store chunks and journal.").Envar("COOKFS_DATA_DIR").PlaceHolder("data").String()
+	listen := kingpin.Flag("listen", "Address to listen on. Defaults to the port of the advertised URL.").PlaceHolder("HOST:PORT").String()
+
+	overrides := []func(){
+		durationFlag("alive-interval", "Interval of alive messages from leader.", &c.AliveInterval),
+		durationFlag("alive-timeout", "Timeout of each alive message.", &c.AliveTimeout),
+		durationFlag("leader-death-timer", "Time to wait alive message before candidacy.", &c.LeaderDeathTimer),
+		durationFlag("candidacy-wait-min", "Minimum wait before candidacy.", &c.CandidacyWaitMin),
+		durationFlag("candidacy-wait-max", "Maximum wait before candidacy.", &c.CandidacyWaitMax),
+		durationFlag("candidacy-timeout", "Timeout of polling for candidacy.", &c.CandidacyTimeout),
+		durationFlag("polling-window", "Time window to collect polling requests.", &c.PollingWindow),
+		durationFlag("commit-timeout", "Timeout of replicating a patch.", &c.CommitTimeout),
+		durationFlag("repair-interval", "Interval of chunk repair.", &c.RepairInterval),
+		durationFlag("gc-interval", "Interval of garbage collection.", &c.GCInterval),
+		durationFlag("gc-grace-period", "Time to keep unreferenced chunks.", &c.GCGracePeriod),
+		intFlag("send-workers", "Number of workers to send messages.", &c.SendWorkersNum),
+		intFlag("patch-retention", "Number of applied patches to keep for catching up.", &c.PatchRetention),
+		intFlag("checkpoint-interval", "Number of patches between checkpoints.", &c.CheckpointInterval),
+		intFlag("replication-factor", "Number of nodes to store each chunk.", &c.ReplicationFactor),
+		intFlag("max-read-lag", "Number of patches a follower may lag behind for bounded-staleness reads.", &c.MaxReadLag),
+		intFlag("priority", "Election priority. Higher priority nodes are preferred as leader.", &c.Priority),
+		boolFlag("never-leader", "Never become leader.", &c.NeverLeader),
+	}
+
+	advertise := kingpin.Arg("advertise", "URL of this node that other nodes use.").URL()
+	peers := kingpin.Arg("peers", "URLs of other nodes.").URLList()
+
+	kingpin.Parse()
+
+	if *configFile != "" {
+		if err := LoadConfig(*configFile, &config); err != nil {
+			fail(fmt.Errorf("failed to load config: %s", err.Error()))
+		}
+	}
+
+	for _, override := range overrides {
+		override()
+	}
+	setString(*dataDir, &config.DataDir)
+	setString(*listen, &config.Listen)
+	if *advertise != nil {
+		config.Advertise = (*advertise).String()
+	}
+	if len(*peers) > 0 {
+		config.Peers = []string{}
+		for _, p := range *peers {
+			config.Peers = append(config.Peers, p.String())
+		}
+	}
+
+	if config.Advertise == "" {
+		fail(fmt.Errorf("advertise URL is required"))
+	}
+	if err := config.Config.Validate(); err != nil {
+		fail(fmt.Errorf("invalid config: %s", err.Error()))
+	}
+
+	nodes := []*cooklib.Node{}
+	for _, x := range append([]string{config.Advertise}, config.Peers...) {
+		node, err := cooklib.ParseNode(x)
+		if err != nil {
+			fail(fmt.Errorf("invalid node URL: %s", x))
+		}
+		nodes = append(nodes, node)
+	}
+	bootstrap := func() []*cooklib.Node {
+		return nodes
+	}
+
+	if config.Listen == "" {
+		config.Listen = ":" + nodes[0].Port()
+	}
+
 	h := &plugins.HTTPHandler{}
 
-	c := cooklib.NewCookFS(h, Nodes, cooklib.DefaultConfig)
-	go c.RunFollower(ctx)
+	cookfs := cooklib.NewCookFS(h, bootstrap, config.Config)
+
+	store, err := cooklib.NewFileChunkStore(filepath.Join(config.DataDir, "chunks"))
+	if err != nil {
+		fail(err)
+	}
+	cookfs.Chunks = store
+
+	journal, err := cooklib.OpenJournal(filepath.Join(config.DataDir, "journal"))
+	if err != nil {
+		fail(err)
+	}
+	cookfs.Journal = journal
+
+	if err := cookfs.Restore(); err != nil {
+		fail(err)
+	}
+
+	go cookfs.RunFollower(ctx)
 
-	h.Listen(ctx, Nodes()[0], c)
+	h.Listen(ctx, (*cooklib.Node)(&url.URL{Scheme: nodes[0].Scheme, Host: config.Listen}), cookfs)
 }
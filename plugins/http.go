@@ -3,15 +3,23 @@ package plugins
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/vmihailenco/msgpack"
 
 	"github.com/macrat/cookfs/cooklib"
 )
 
+const (
+	MaxChunkSize = 64 * 1024 * 1024
+)
+
 type HTTPHandler http.Client
 
 func processSet(c *cooklib.CookFS, path string, body io.ReadCloser) cooklib.Response {
@@ -25,16 +33,83 @@ func processSet(c *cooklib.CookFS, path string, body io.ReadCloser) cooklib.Resp
 	}
 	body.Close()
 
-	return c.HandleRequest(cooklib.Request{c.Nodes()[0], path, data, 0})
+	return c.HandleRequest(cooklib.Request{c.Self(), path, data, 0})
 }
 
 func processGet(c *cooklib.CookFS, path string) cooklib.Response {
-	return c.HandleRequest(cooklib.Request{c.Nodes()[0], path, nil, 0})
+	return c.HandleRequest(cooklib.Request{c.Self(), path, nil, 0})
+}
+
+func writeResponse(w http.ResponseWriter, response cooklib.Response) {
+	data, err := msgpack.Marshal(response.Data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-msgpack")
+	w.WriteHeader(response.StatusCode)
+	w.Write(data)
+}
+
+func serveChunk(c *cooklib.CookFS, w http.ResponseWriter, r *http.Request) {
+	id, err := cooklib.ParseChunkID(strings.TrimPrefix(r.URL.Path, "/chunk/"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		response := c.GetChunk(id)
+		if response.StatusCode != 200 {
+			w.WriteHeader(response.StatusCode)
+			return
+		}
+
+		data := response.Data.([]byte)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+
+	case "HEAD":
+		w.WriteHeader(c.HasChunk(id).StatusCode)
+
+	case "DELETE":
+		w.WriteHeader(c.DeleteChunk(id).StatusCode)
+
+	case "PUT":
+		if r.ContentLength > MaxChunkSize {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxChunkSize))
+		r.Body.Close()
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		writeResponse(w, c.PutChunk(cooklib.Chunk{ID: id, Data: data}))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
 }
 
 func newMux(ctx context.Context, c *cooklib.CookFS) *http.ServeMux {
 	mux := http.NewServeMux()
 
+	mux.HandleFunc("/chunk/", func(w http.ResponseWriter, r *http.Request) {
+		serveChunk(c, w, r)
+	})
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		var response cooklib.Response
 
@@ -44,14 +119,7 @@ func newMux(ctx context.Context, c *cooklib.CookFS) *http.ServeMux {
 			response = processGet(c, r.URL.Path)
 		}
 
-		data, err := msgpack.Marshal(response.Data)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/x-msgpack")
-		w.WriteHeader(response.StatusCode)
-		w.Write(data)
+		writeResponse(w, response)
 	})
 
 	return mux
@@ -59,7 +127,7 @@ func newMux(ctx context.Context, c *cooklib.CookFS) *http.ServeMux {
 
 func (h *HTTPHandler) Listen(ctx context.Context, node *cooklib.Node, c *cooklib.CookFS) {
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", node.Port()),
+		Addr:    node.Host,
 		Handler: newMux(ctx, c),
 	}
 
@@ -90,13 +158,117 @@ func (h *HTTPHandler) Send(ctx context.Context, req cooklib.Request) cooklib.Res
 
 	response, err := (*http.Client)(h).Do(request.WithContext(ctx))
 	if err != nil {
-		fmt.Println(err.Error())
+		if ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
 		return cooklib.Response{StatusCode: http.StatusBadGateway}
 	}
 
-	data, err := msgpack.NewDecoder(response.Body).DecodeInterface()
+	defer response.Body.Close()
+
+	data := cooklib.NewResponseStruct(req.Path)
+	if response.StatusCode == http.StatusTemporaryRedirect {
+		data = &cooklib.AliveMessage{}
+	}
+	if data == nil {
+		data, err = msgpack.NewDecoder(response.Body).DecodeInterface()
+	} else {
+		err = msgpack.NewDecoder(response.Body).Decode(data)
+	}
+	if err != nil {
+		return cooklib.Response{StatusCode: response.StatusCode}
+	}
+	return cooklib.Response{StatusCode: response.StatusCode, Data: data}
+}
+
+func chunkURL(node *cooklib.Node, id cooklib.ChunkID) string {
+	u := *node
+	u.Path = u.Path + "/chunk/" + id.String()
+	return (*cooklib.Node)(&u).String()
+}
+
+func (h *HTTPHandler) SendChunk(ctx context.Context, node *cooklib.Node, chunk cooklib.Chunk) (*cooklib.Node, error) {
+	request, err := http.NewRequest("PUT", chunkURL(node, chunk.ID), bytes.NewReader(chunk.Data))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	response, err := (*http.Client)(h).Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to send chunk %s: %d", chunk.ID, response.StatusCode)
+	}
+
+	var holder cooklib.Node
+	if err := msgpack.NewDecoder(response.Body).Decode(&holder); err != nil {
+		return nil, err
+	}
+
+	return &holder, nil
+}
+
+func (h *HTTPHandler) FetchChunk(ctx context.Context, node *cooklib.Node, id cooklib.ChunkID) ([]byte, error) {
+	request, err := http.NewRequest("GET", chunkURL(node, id), nil)
 	if err != nil {
-		return cooklib.Response{response.StatusCode, nil}
+		return nil, err
+	}
+
+	response, err := (*http.Client)(h).Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch chunk %s: %d", id, response.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(response.Body, MaxChunkSize))
+}
+
+func (h *HTTPHandler) HasChunk(ctx context.Context, node *cooklib.Node, id cooklib.ChunkID) (bool, error) {
+	request, err := http.NewRequest("HEAD", chunkURL(node, id), nil)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := (*http.Client)(h).Do(request.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check chunk %s: %d", id, response.StatusCode)
+	}
+}
+
+func (h *HTTPHandler) DeleteChunk(ctx context.Context, node *cooklib.Node, id cooklib.ChunkID) error {
+	request, err := http.NewRequest("DELETE", chunkURL(node, id), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := (*http.Client)(h).Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to delete chunk %s: %d", id, response.StatusCode)
 	}
-	return cooklib.Response{response.StatusCode, data}
 }
@@ -0,0 +1,144 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/macrat/cookfs/cooklib"
+)
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *cooklib.CookFS) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	nodes := func() []*cooklib.Node { return []*cooklib.Node{cooklib.MustParseNode("http://localhost:5790")} }
+	c := cooklib.NewCookFS(nil, nodes, cooklib.DefaultConfig)
+
+	srv := httptest.NewServer(newMux(ctx, c))
+	t.Cleanup(srv.Close)
+
+	return srv, c
+}
+
+func doRequest(t *testing.T, method, url string, body io.Reader) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err.Error())
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %s", err.Error())
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func Test_serveChunk_Put(t *testing.T) {
+	srv, c := newTestServer(t)
+
+	data := []byte("hello world")
+	id := cooklib.NewChunkID(data)
+
+	if resp := doRequest(t, "PUT", srv.URL+"/chunk/"+id.String(), bytes.NewReader(data)); resp.StatusCode != 200 {
+		t.Errorf("unexcepted status code: %d", resp.StatusCode)
+	}
+	if !c.Chunks.Has(id) {
+		t.Errorf("uploaded chunk must be stored")
+	}
+
+	other := cooklib.NewChunkID([]byte("other"))
+	if resp := doRequest(t, "PUT", srv.URL+"/chunk/"+other.String(), bytes.NewReader(data)); resp.StatusCode != 400 {
+		t.Errorf("must reject chunk with mismatched hash: %d", resp.StatusCode)
+	}
+	if c.Chunks.Has(other) {
+		t.Errorf("mismatched chunk must not be stored")
+	}
+
+	if resp := doRequest(t, "PUT", srv.URL+"/chunk/"+other.String(), bytes.NewReader(make([]byte, MaxChunkSize+1))); resp.StatusCode != 413 {
+		t.Errorf("must reject too large chunk: %d", resp.StatusCode)
+	}
+
+	body := ioutil.NopCloser(io.LimitReader(zeroReader{}, MaxChunkSize+1))
+	if resp := doRequest(t, "PUT", srv.URL+"/chunk/"+other.String(), body); resp.StatusCode != 413 {
+		t.Errorf("must reject too large chunk without length: %d", resp.StatusCode)
+	}
+}
+
+func Test_serveChunk_Get(t *testing.T) {
+	srv, c := newTestServer(t)
+
+	data := []byte("hello world")
+	id := cooklib.NewChunkID(data)
+	c.Chunks.Put(id, data)
+
+	resp := doRequest(t, "GET", srv.URL+"/chunk/"+id.String(), nil)
+	if resp.StatusCode != 200 {
+		t.Fatalf("unexcepted status code: %d", resp.StatusCode)
+	}
+	if resp.ContentLength != int64(len(data)) {
+		t.Errorf("unexcepted content length: %d", resp.ContentLength)
+	}
+	if got, _ := ioutil.ReadAll(resp.Body); !bytes.Equal(got, data) {
+		t.Errorf("unexcepted data: %q", got)
+	}
+
+	if resp := doRequest(t, "HEAD", srv.URL+"/chunk/"+id.String(), nil); resp.StatusCode != 200 {
+		t.Errorf("unexcepted status code of HEAD: %d", resp.StatusCode)
+	}
+
+	missing := cooklib.NewChunkID([]byte("missing"))
+	if resp := doRequest(t, "GET", srv.URL+"/chunk/"+missing.String(), nil); resp.StatusCode != 404 {
+		t.Errorf("must return 404 for missing chunk: %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, "HEAD", srv.URL+"/chunk/"+missing.String(), nil); resp.StatusCode != 404 {
+		t.Errorf("must return 404 for missing chunk on HEAD: %d", resp.StatusCode)
+	}
+
+	if resp := doRequest(t, "GET", srv.URL+"/chunk/invalid", nil); resp.StatusCode != 404 {
+		t.Errorf("must return 404 for invalid chunk ID: %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, "POST", srv.URL+"/chunk/"+id.String(), nil); resp.StatusCode != 405 {
+		t.Errorf("must reject unsupported method: %d", resp.StatusCode)
+	}
+}
+
+func Test_serveChunk_Delete(t *testing.T) {
+	srv, c := newTestServer(t)
+
+	data := []byte("hello world")
+	id := cooklib.NewChunkID(data)
+	c.Chunks.Put(id, data)
+
+	if resp := doRequest(t, "DELETE", srv.URL+"/chunk/"+id.String(), nil); resp.StatusCode != 200 {
+		t.Errorf("unexcepted status code: %d", resp.StatusCode)
+	}
+	if c.Chunks.Has(id) {
+		t.Errorf("deleted chunk must be removed")
+	}
+	if resp := doRequest(t, "DELETE", srv.URL+"/chunk/"+id.String(), nil); resp.StatusCode != 404 {
+		t.Errorf("must return 404 for missing chunk: %d", resp.StatusCode)
+	}
+
+	doRequest(t, "PUT", srv.URL+"/chunk/"+id.String(), bytes.NewReader(data))
+	if resp := doRequest(t, "DELETE", srv.URL+"/chunk/"+id.String(), nil); resp.StatusCode != 409 {
+		t.Errorf("must not delete recently uploaded chunk: %d", resp.StatusCode)
+	}
+}